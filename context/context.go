@@ -2,8 +2,11 @@ package context
 
 import (
 	"errors"
+	"reflect"
 	"sync"
 	"time"
+
+	clock "github.com/YaoZengzeng/gok8s/fakeclock"
 )
 
 type Context interface {
@@ -17,6 +20,10 @@ type Context interface {
 
 	// Deadline returns the time when this Context will be canceled, if any.
 	Deadline() (deadline time.Time, ok bool)
+
+	// Value returns the value associated with this context for key, or nil
+	// if no value is associated with key.
+	Value(key interface{}) interface{}
 }
 
 var Canceled = errors.New("context canceled")
@@ -37,6 +44,10 @@ func (*emptyCtx) Deadline() (deadline time.Time, ok bool) {
 	return
 }
 
+func (*emptyCtx) Value(key interface{}) interface{} {
+	return nil
+}
+
 var (
 	background = new(emptyCtx)
 	todo       = new(emptyCtx)
@@ -156,13 +167,18 @@ func propagateCancel(parent Context, child canceler) {
 }
 
 func parentCancelCtx(parent Context) (*cancelCtx, bool) {
-	switch c := parent.(type) {
-	case *cancelCtx:
-		return c, true
-	case *timerCtx:
-		return &c.cancelCtx, true
+	for {
+		switch c := parent.(type) {
+		case *cancelCtx:
+			return c, true
+		case *timerCtx:
+			return &c.cancelCtx, true
+		case *valueCtx:
+			parent = c.Context
+		default:
+			return nil, false
+		}
 	}
-	return nil, false
 }
 
 // removeChild removes a context from its parent.
@@ -179,10 +195,21 @@ func removeChild(parent Context, child canceler) {
 }
 
 func WithTimeout(parent Context, timeout time.Duration) (Context, CancelFunc) {
-	return WithDeadline(parent, time.Now().Add(timeout))
+	return WithTimeoutClock(parent, timeout, clock.RealClock{})
 }
 
 func WithDeadline(parent Context, d time.Time) (Context, CancelFunc) {
+	return WithDeadlineClock(parent, d, clock.RealClock{})
+}
+
+// WithTimeoutClock is like WithTimeout, but the timeout is measured by clk.
+func WithTimeoutClock(parent Context, timeout time.Duration, clk clock.Clock) (Context, CancelFunc) {
+	return WithDeadlineClock(parent, clk.Now().Add(timeout), clk)
+}
+
+// WithDeadlineClock is like WithDeadline, but the deadline is checked against
+// clk, so that tests can pass a fake clock and step it past d.
+func WithDeadlineClock(parent Context, d time.Time, clk clock.Clock) (Context, CancelFunc) {
 	if cur, ok := parent.Deadline(); ok && cur.Before(d) {
 		// The current deadline is already sooner than the new one.
 		return WithCancel(parent)
@@ -192,7 +219,7 @@ func WithDeadline(parent Context, d time.Time) (Context, CancelFunc) {
 		deadline:  d,
 	}
 	propagateCancel(parent, c)
-	dur := time.Until(d)
+	dur := d.Sub(clk.Now())
 	if dur <= 0 {
 		c.cancel(true, DeadlineExceeded) // deadline has already passed
 		return c, func() { c.cancel(true, Canceled) }
@@ -200,7 +227,7 @@ func WithDeadline(parent Context, d time.Time) (Context, CancelFunc) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.err == nil {
-		c.timer = time.AfterFunc(dur, func() {
+		c.timer = clk.AfterFunc(dur, func() {
 			c.cancel(true, DeadlineExceeded)
 		})
 	}
@@ -212,7 +239,7 @@ func WithDeadline(parent Context, d time.Time) (Context, CancelFunc) {
 // delegating to cancelCtx.cancel.
 type timerCtx struct {
 	cancelCtx
-	timer *time.Timer // Under cancelCtx.mu
+	timer clock.Timer // Under cancelCtx.mu
 
 	deadline time.Time
 }
@@ -234,3 +261,30 @@ func (c *timerCtx) cancel(removeFromParent bool, err error) {
 	}
 	c.mu.Unlock()
 }
+
+// WithValue returns a copy of parent in which the value associated with key
+// is val. The key must be comparable and should not be of a built-in type, to
+// avoid collisions between packages using context.
+func WithValue(parent Context, key, val interface{}) Context {
+	if key == nil {
+		panic("nil key")
+	}
+	if !reflect.TypeOf(key).Comparable() {
+		panic("key is not comparable")
+	}
+	return &valueCtx{parent, key, val}
+}
+
+// A valueCtx carries a key-value pair. It implements Value for that key and
+// delegates all other calls to the embedded Context.
+type valueCtx struct {
+	Context
+	key, val interface{}
+}
+
+func (c *valueCtx) Value(key interface{}) interface{} {
+	if c.key == key {
+		return c.val
+	}
+	return c.Context.Value(key)
+}
@@ -5,6 +5,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	clock "github.com/YaoZengzeng/gok8s/fakeclock"
 )
 
 func TestBackground(t *testing.T) {
@@ -262,3 +264,153 @@ func TestTimeout(t *testing.T) {
 	c, _ = WithTimeout(o, 3*time.Second)
 	testDeadline(c, "WithTimeout+otherContext+WithTimeout", 2*time.Second, t)
 }
+
+func TestDeadlineClock(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c, cancel := WithDeadlineClock(Background(), fc.Now().Add(time.Hour), fc)
+	defer cancel()
+
+	if d, ok := c.Deadline(); !ok || !d.Equal(fc.Now().Add(time.Hour)) {
+		t.Errorf("c.Deadline() == %v, %v; want %v, true", d, ok, fc.Now().Add(time.Hour))
+	}
+	fc.Step(time.Hour - time.Millisecond)
+	select {
+	case <-c.Done():
+		t.Fatalf("context shouldn't have timed out before the deadline")
+	default:
+	}
+
+	fc.Step(time.Millisecond)
+	select {
+	case <-c.Done():
+	default:
+		t.Fatalf("context should have timed out once the fake clock passed the deadline")
+	}
+	if e := c.Err(); e != DeadlineExceeded {
+		t.Errorf("c.Err() == %v; want %v", e, DeadlineExceeded)
+	}
+
+	c, _ = WithDeadlineClock(Background(), fc.Now(), fc)
+	testDeadline(c, "WithDeadlineClock+now", time.Second, t)
+}
+
+func TestTimeoutClock(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c, _ := WithTimeoutClock(Background(), time.Minute, fc)
+	fc.Step(time.Minute)
+	testDeadline(c, "WithTimeoutClock", time.Second, t)
+
+	c, cancel := WithTimeoutClock(Background(), time.Minute, fc)
+	if !fc.HasWaiters() {
+		t.Errorf("expected WithTimeoutClock to wait on the fake clock")
+	}
+	cancel()
+	if fc.HasWaiters() {
+		t.Errorf("expected cancel to stop the timer of the fake clock")
+	}
+	if e := c.Err(); e != Canceled {
+		t.Errorf("c.Err() == %v; want %v", e, Canceled)
+	}
+}
+
+type key1 int
+type key2 int
+
+var k1 = key1(1)
+var k2 = key2(1) // same int as k1, different type
+var k3 = key2(3) // same type as k2, different int
+
+func TestValues(t *testing.T) {
+	check := func(c Context, nm, v1, v2, v3 string) {
+		if v, ok := c.Value(k1).(string); ok == (len(v1) == 0) || v != v1 {
+			t.Errorf(`%s.Value(k1).(string) = %q, %t want %q, %t`, nm, v, ok, v1, len(v1) != 0)
+		}
+		if v, ok := c.Value(k2).(string); ok == (len(v2) == 0) || v != v2 {
+			t.Errorf(`%s.Value(k2).(string) = %q, %t want %q, %t`, nm, v, ok, v2, len(v2) != 0)
+		}
+		if v, ok := c.Value(k3).(string); ok == (len(v3) == 0) || v != v3 {
+			t.Errorf(`%s.Value(k3).(string) = %q, %t want %q, %t`, nm, v, ok, v3, len(v3) != 0)
+		}
+	}
+
+	c0 := Background()
+	check(c0, "c0", "", "", "")
+
+	c1 := WithValue(Background(), k1, "c1k1")
+	check(c1, "c1", "c1k1", "", "")
+
+	c2 := WithValue(c1, k2, "c2k2")
+	check(c2, "c2", "c1k1", "c2k2", "")
+
+	c3 := WithValue(c2, k3, "c3k3")
+	check(c3, "c2", "c1k1", "c2k2", "c3k3")
+
+	c4 := WithValue(c3, k1, nil)
+	check(c4, "c4", "", "c2k2", "c3k3")
+
+	o0 := otherContext{Background()}
+	check(o0, "o0", "", "", "")
+
+	o1 := otherContext{WithValue(Background(), k1, "c1k1")}
+	check(o1, "o1", "c1k1", "", "")
+
+	o2 := WithValue(o1, k2, "o2k2")
+	check(o2, "o2", "c1k1", "o2k2", "")
+
+	o3 := otherContext{c4}
+	check(o3, "o3", "", "c2k2", "c3k3")
+
+	o4 := WithValue(o3, k3, nil)
+	check(o4, "o4", "", "c2k2", "")
+
+	c5, cancel5 := WithCancel(c3)
+	defer cancel5()
+	check(c5, "c5", "c1k1", "c2k2", "c3k3")
+
+	c6, cancel6 := WithTimeout(c5, time.Hour)
+	defer cancel6()
+	check(c6, "c6", "c1k1", "c2k2", "c3k3")
+}
+
+func TestWithValueChecksKey(t *testing.T) {
+	panicVal := func(f func()) (v interface{}) {
+		defer func() { v = recover() }()
+		f()
+		return
+	}
+
+	if panicVal(func() { WithValue(Background(), nil, "bar") }) == nil {
+		t.Errorf("expected a panic for a nil key")
+	}
+	if panicVal(func() { WithValue(Background(), []byte("foo"), "bar") }) == nil {
+		t.Errorf("expected a panic for a key which isn't comparable")
+	}
+}
+
+func TestValueCtxPropagatesCancel(t *testing.T) {
+	parent, cancel := WithCancel(Background())
+	child, _ := WithCancel(WithValue(parent, k1, "v"))
+
+	// the child is registered with its cancelCtx ancestor, no goroutine is
+	// needed to propagate the cancellation
+	p, _ := parentCancelCtx(parent)
+	p.mu.Lock()
+	n := len(p.children)
+	p.mu.Unlock()
+	if e, a := 1, n; e != a {
+		t.Errorf("expected %v children, got %v", e, a)
+	}
+
+	cancel()
+	select {
+	case <-child.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("child should have been canceled")
+	}
+	if e := child.Err(); e != Canceled {
+		t.Errorf("child.Err() == %v; want %v", e, Canceled)
+	}
+	if v := child.Value(k1); v != "v" {
+		t.Errorf("child.Value(k1) == %v; want v", v)
+	}
+}
@@ -0,0 +1,57 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRealClock(t *testing.T) {
+	c := RealClock{}
+	start := c.Now()
+	if c.Since(start) < 0 {
+		t.Errorf("expected non-negative duration since %v", start)
+	}
+
+	select {
+	case <-c.After(time.Millisecond):
+	case <-time.After(time.Second):
+		t.Errorf("After didn't fire")
+	}
+
+	timer := c.NewTimer(time.Hour)
+	if !timer.Stop() {
+		t.Errorf("expected Stop of an active timer to return true")
+	}
+	timer.Reset(time.Millisecond)
+	select {
+	case <-timer.C():
+	case <-time.After(time.Second):
+		t.Errorf("timer didn't fire after Reset")
+	}
+
+	ticker := c.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ticker.C():
+		case <-time.After(time.Second):
+			t.Fatalf("ticker didn't tick")
+		}
+	}
+}
+
+func TestRealClockAfterFunc(t *testing.T) {
+	c := RealClock{}
+	called := make(chan struct{})
+	c.AfterFunc(time.Millisecond, func() { close(called) })
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Errorf("AfterFunc didn't call the function")
+	}
+
+	stopped := c.AfterFunc(time.Hour, func() { t.Errorf("unexpected call of a stopped AfterFunc") })
+	if !stopped.Stop() {
+		t.Errorf("expected Stop of a pending AfterFunc to return true")
+	}
+}
@@ -1,33 +1,95 @@
 package clock
 
 import (
+	"context"
 	"sync"
 	"time"
-)
 
-type Clock interface {
-	Now() time.Time
-	Since(time.Time) time.Duration
-	After(time.Duration) <-chan time.Time
-	NewTimer(time.Duration) Timer
-	Sleep(time.Duration)
-	NewTicker(time.Duration) Ticker
-}
+	"github.com/YaoZengzeng/gok8s/heap"
+)
 
 type FakeClock struct {
 	lock sync.RWMutex
+	// time is the monotonic time of the clock, which drives Since and the
+	// waiters. It is expressed as the wall time it would be without any
+	// wall clock jump.
 	time time.Time
 
-	// waiters are waiting for the fake time to pass their specified time
-	waiters []*fakeClockWaiter
+	// wallOffset is the sum of the wall clock jumps, Now returns time
+	// moved by wallOffset
+	wallOffset time.Duration
+	// wallJumps records the jumps of the wall clock, in order
+	wallJumps []wallJump
+	// location is the time zone of the times returned by Now, if not nil
+	location *time.Location
+
+	// waiters are waiting for the fake time to pass their specified time,
+	// ordered by it
+	waiters waiterHeap
+	// waiterSeq orders the waiters of a same time by registration
+	waiterSeq uint64
+	// waitersChanged is closed and replaced whenever waiters changes
+	waitersChanged chan struct{}
+	// autoAdvancing is the number of running auto advance loops
+	autoAdvancing int
 }
 
+var _ Clock = &FakeClock{}
+
 type fakeClockWaiter struct {
 	targetTime    time.Time
 	stepInterval  time.Duration
 	skipIfBlocked bool
 	destChan      chan time.Time
-	fired         bool
+	afterFunc     func()
+
+	// seq is the registration order of the waiter
+	seq uint64
+	// index is the position of the waiter in waiters while it is registered
+	index int
+}
+
+// wallJump is a jump of the wall clock at a monotonic time. offset is the
+// wallOffset used until the jump.
+type wallJump struct {
+	at     time.Time
+	offset time.Duration
+}
+
+// waiterHeap implements heap.Interface, the earliest waiter is at the top.
+type waiterHeap []*fakeClockWaiter
+
+func (h waiterHeap) Len() int {
+	return len(h)
+}
+
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].targetTime.Equal(h[j].targetTime) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].targetTime.Before(h[j].targetTime)
+}
+
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waiterHeap) Push(x interface{}) {
+	w := x.(*fakeClockWaiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *waiterHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*h = old[:n-1]
+	return w
 }
 
 func NewFakeClock(t time.Time) *FakeClock {
@@ -36,24 +98,97 @@ func NewFakeClock(t time.Time) *FakeClock {
 	}
 }
 
+// Now returns the wall time of the clock, in the location set by SetLocation.
 func (f *FakeClock) Now() time.Time {
 	f.lock.RLock()
 	defer f.lock.RUnlock()
-	return f.time
+	return f.nowLocked()
 }
 
+// nowLocked returns the wall time of the clock. f must be locked.
+func (f *FakeClock) nowLocked() time.Time {
+	now := f.time.Add(f.wallOffset)
+	if f.location != nil {
+		now = now.In(f.location)
+	}
+	return now
+}
+
+// Since returns the monotonic time elapsed since ts, which isn't affected by
+// the jumps of the wall clock between ts and now when ts was returned by Now.
 func (f *FakeClock) Since(ts time.Time) time.Duration {
 	f.lock.RLock()
 	defer f.lock.RUnlock()
-	return f.time.Sub(ts)
+	return f.time.Sub(f.monotonicLocked(ts))
+}
+
+// monotonicLocked returns the monotonic time at which Now returned the wall
+// time ts. As the wall clock may go back, the latest such time which isn't in
+// the future is returned. If Now never returned ts, ts is assumed to be taken
+// with the current wall clock offset. f must be locked.
+func (f *FakeClock) monotonicLocked(ts time.Time) time.Time {
+	current := ts.Add(-f.wallOffset)
+	if len(f.wallJumps) == 0 {
+		return current
+	}
+	if !current.After(f.time) && !current.Before(f.wallJumps[len(f.wallJumps)-1].at) {
+		return current
+	}
+	for i := len(f.wallJumps) - 1; i >= 0; i-- {
+		m := ts.Add(-f.wallJumps[i].offset)
+		if m.After(f.wallJumps[i].at) {
+			continue
+		}
+		if i == 0 || !m.Before(f.wallJumps[i-1].at) {
+			return m
+		}
+	}
+	return current
+}
+
+// StepWall moves the wall clock by d without moving the monotonic time, like
+// an NTP correction does: Now reflects the jump, Since and the waiters don't.
+func (f *FakeClock) StepWall(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.jumpWallLocked(d)
+}
+
+// SetWallTime sets the wall clock to t without moving the monotonic time, see
+// StepWall.
+func (f *FakeClock) SetWallTime(t time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.jumpWallLocked(t.Sub(f.time.Add(f.wallOffset)))
+}
+
+// jumpWallLocked moves the wall clock by d. f must be write-locked.
+func (f *FakeClock) jumpWallLocked(d time.Duration) {
+	if d == 0 {
+		return
+	}
+	f.wallJumps = append(f.wallJumps, wallJump{
+		at:     f.time,
+		offset: f.wallOffset,
+	})
+	f.wallOffset += d
+}
+
+// SetLocation sets the time zone of the times returned by Now, so that code
+// depending on daylight saving time can be tested. A nil loc returns times in
+// the location of the time the clock was created with.
+func (f *FakeClock) SetLocation(loc *time.Location) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.location = loc
 }
 
 func (f *FakeClock) After(d time.Duration) <-chan time.Time {
-	f.lock.RLock()
-	defer f.lock.RUnlock()
+	f.lock.Lock()
+	defer f.lock.Unlock()
 	stopTime := f.time.Add(d)
 	ch := make(chan time.Time, 1)
-	f.waiters = append(f.waiters, &fakeClockWaiter{
+	f.addWaiterLocked(&fakeClockWaiter{
 		targetTime: stopTime,
 		destChan:   ch,
 	})
@@ -65,7 +200,7 @@ func (f *FakeClock) Tick(d time.Duration) <-chan time.Time {
 	defer f.lock.Unlock()
 	tickTime := f.time.Add(d)
 	ch := make(chan time.Time, 1)
-	f.waiters = append(f.waiters, &fakeClockWaiter{
+	f.addWaiterLocked(&fakeClockWaiter{
 		targetTime:    tickTime,
 		stepInterval:  d,
 		skipIfBlocked: true,
@@ -75,48 +210,136 @@ func (f *FakeClock) Tick(d time.Duration) <-chan time.Time {
 	return ch
 }
 
-// Move clock by Duration, notify anyone that's called After, Tick, or NewTimer
+// Move clock by Duration, notify anyone that's called After, Tick, or NewTimer,
+// and run the functions of AfterFunc which are due
 func (f *FakeClock) Step(d time.Duration) {
 	f.lock.Lock()
-	defer f.lock.Unlock()
-	f.setTimeLocked(f.time.Add(d))
+	afterFuncs := f.setTimeLocked(f.time.Add(d))
+	f.lock.Unlock()
+	runAfterFuncs(afterFuncs)
 }
 
+// SetTime moves the clock so that Now returns t, moving the monotonic time by
+// as much as the wall clock.
 func (f *FakeClock) SetTime(t time.Time) {
 	f.lock.Lock()
-	defer f.lock.Unlock()
-	f.setTimeLocked(t)
+	afterFuncs := f.setTimeLocked(t.Add(-f.wallOffset))
+	f.lock.Unlock()
+	runAfterFuncs(afterFuncs)
 }
 
-// Actually changes the time and checks any waiters. f must be write-locked.
-func (f *FakeClock) setTimeLocked(t time.Time) {
+// Actually changes the monotonic time and checks any waiters, in the order of
+// their target time. f must be write-locked. The functions of AfterFunc which are
+// due are returned, so that they can be run once f is unlocked.
+func (f *FakeClock) setTimeLocked(t time.Time) []func() {
 	f.time = t
-	newWaiters := make([]*fakeClockWaiter, 0, len(f.waiters))
-	for i := range f.waiters {
-		w := f.waiters[i]
-		if !w.targetTime.After(t) {
-			if w.skipIfBlocked {
-				select {
-				case w.destChan <- t:
-					w.fired = true
-				default:
-				}
-			} else {
-				w.destChan <- t
-				w.fired = true
-			}
+	now := f.nowLocked()
+	var afterFuncs []func()
+	removed := false
+	for len(f.waiters) > 0 && !f.waiters[0].targetTime.After(t) {
+		w := f.waiters[0]
+		if w.afterFunc != nil {
+			afterFuncs = append(afterFuncs, w.afterFunc)
+		} else {
+			w.deliver(now)
+		}
 
-			if w.stepInterval > 0 {
-				for !w.targetTime.After(t) {
-					w.targetTime = w.targetTime.Add(w.stepInterval)
-				}
-				newWaiters = append(newWaiters, w)
+		if w.stepInterval > 0 {
+			for !w.targetTime.After(t) {
+				w.targetTime = w.targetTime.Add(w.stepInterval)
 			}
+			heap.Fix(&f.waiters, 0)
 		} else {
-			newWaiters = append(newWaiters, w)
+			heap.Pop(&f.waiters)
+			removed = true
+		}
+	}
+	if removed {
+		f.notifyWaitersChangedLocked()
+	}
+	return afterFuncs
+}
+
+// deliver sends t on the channel of w without blocking, like the runtime
+// does for real timers: a tick nobody is ready for is dropped, and the stale
+// value of a timer is replaced by t. Values are only sent with the lock of
+// the clock held, so that the channel can't be refilled behind our back.
+func (w *fakeClockWaiter) deliver(t time.Time) {
+	for {
+		select {
+		case w.destChan <- t:
+			return
+		default:
+		}
+		if w.skipIfBlocked {
+			return
 		}
+		w.drain()
+	}
+}
+
+// drain discards a value sent on the channel of w and not received yet.
+func (w *fakeClockWaiter) drain() {
+	select {
+	case <-w.destChan:
+	default:
+	}
+}
+
+func runAfterFuncs(afterFuncs []func()) {
+	for _, fn := range afterFuncs {
+		fn()
+	}
+}
+
+// addWaiterLocked registers w. f must be write-locked.
+func (f *FakeClock) addWaiterLocked(w *fakeClockWaiter) {
+	f.waiterSeq++
+	w.seq = f.waiterSeq
+	heap.Push(&f.waiters, w)
+	f.notifyWaitersChangedLocked()
+}
+
+// removeWaiterLocked unregisters w. f must be write-locked.
+func (f *FakeClock) removeWaiterLocked(w *fakeClockWaiter) {
+	if !f.hasWaiterLocked(w) {
+		return
+	}
+	heap.Remove(&f.waiters, w.index)
+	f.notifyWaitersChangedLocked()
+}
+
+// rescheduleWaiterLocked moves w to targetTime, registering it again if
+// needed. f must be write-locked.
+func (f *FakeClock) rescheduleWaiterLocked(w *fakeClockWaiter, targetTime time.Time) {
+	w.targetTime = targetTime
+	if f.hasWaiterLocked(w) {
+		heap.Fix(&f.waiters, w.index)
+		return
+	}
+	f.addWaiterLocked(w)
+}
+
+// waitersChangedLocked returns a channel closed once waiters changes. f must
+// be write-locked.
+func (f *FakeClock) waitersChangedLocked() <-chan struct{} {
+	if f.waitersChanged == nil {
+		f.waitersChanged = make(chan struct{})
 	}
-	f.waiters = newWaiters
+	return f.waitersChanged
+}
+
+// notifyWaitersChangedLocked wakes up WaitForWaiters. f must be write-locked.
+func (f *FakeClock) notifyWaitersChangedLocked() {
+	if f.waitersChanged != nil {
+		close(f.waitersChanged)
+		f.waitersChanged = nil
+	}
+}
+
+// hasWaiterLocked returns whether w is registered. f must be locked.
+func (f *FakeClock) hasWaiterLocked(w *fakeClockWaiter) bool {
+	return w.index >= 0 && w.index < len(f.waiters) && f.waiters[w.index] == w
 }
 
 func (f *FakeClock) HasWaiters() bool {
@@ -125,8 +348,139 @@ func (f *FakeClock) HasWaiters() bool {
 	return len(f.waiters) > 0
 }
 
+// Waiters returns the number of timers, tickers and AfterFunc calls which
+// are waiting for the fake time to pass their specified time.
+func (f *FakeClock) Waiters() int {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return len(f.waiters)
+}
+
+// BlockUntil blocks until at least n waiters are registered, see
+// WaitForWaiters.
+func (f *FakeClock) BlockUntil(n int) {
+	f.WaitForWaiters(context.Background(), n)
+}
+
+// WaitForWaiters blocks until at least n waiters are registered or ctx is
+// done, in which case the error of ctx is returned. Tests call it before
+// Step to make sure the code under test has called After, NewTimer,
+// NewTicker or AfterFunc.
+func (f *FakeClock) WaitForWaiters(ctx context.Context, n int) error {
+	for {
+		f.lock.Lock()
+		if len(f.waiters) >= n {
+			f.lock.Unlock()
+			return nil
+		}
+		changed := f.waitersChangedLocked()
+		f.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Sleep moves the clock by d. While the clock auto advances, Sleep instead
+// blocks until the fake time passes d from now, like the real one.
 func (f *FakeClock) Sleep(d time.Duration) {
-	f.Step(d)
+	f.lock.RLock()
+	autoAdvancing := f.autoAdvancing > 0
+	f.lock.RUnlock()
+	if !autoAdvancing {
+		f.Step(d)
+		return
+	}
+	if d <= 0 {
+		return
+	}
+	<-f.After(d)
+}
+
+// AdvanceToNext moves the clock to the earliest time a waiter is waiting for
+// and notifies the waiters which are due. It returns the new time, and false
+// if there was no waiter to advance to.
+func (f *FakeClock) AdvanceToNext() (time.Time, bool) {
+	f.lock.Lock()
+	if len(f.waiters) == 0 {
+		now := f.nowLocked()
+		f.lock.Unlock()
+		return now, false
+	}
+	next := f.waiters[0].targetTime
+	if next.Before(f.time) {
+		next = f.time
+	}
+	afterFuncs := f.setTimeLocked(next)
+	now := f.nowLocked()
+	f.lock.Unlock()
+	runAfterFuncs(afterFuncs)
+	return now, true
+}
+
+// StartAutoAdvance turns the clock into a simulated one: once its waiters
+// haven't changed for idle of real time, the goroutines using the clock are
+// assumed to be blocked on it and the clock jumps to the next waiter with
+// AdvanceToNext. idle must be long enough for the goroutines woken by a jump
+// to register their next waiter, otherwise the clock may jump ahead of them.
+//
+// The returned function stops auto advancing.
+func (f *FakeClock) StartAutoAdvance(idle time.Duration) (stop func()) {
+	f.lock.Lock()
+	f.autoAdvancing++
+	f.lock.Unlock()
+
+	stopCh := make(chan struct{})
+	go f.autoAdvanceLoop(idle, stopCh)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopCh)
+			f.lock.Lock()
+			f.autoAdvancing--
+			f.lock.Unlock()
+		})
+	}
+}
+
+func (f *FakeClock) autoAdvanceLoop(idle time.Duration, stopCh <-chan struct{}) {
+	idleTimer := time.NewTimer(idle)
+	defer idleTimer.Stop()
+
+	for {
+		f.lock.Lock()
+		changed := f.waitersChangedLocked()
+		f.lock.Unlock()
+
+		if !idleTimer.Stop() {
+			select {
+			case <-idleTimer.C:
+			default:
+			}
+		}
+		idleTimer.Reset(idle)
+
+		select {
+		case <-stopCh:
+			return
+		case <-changed:
+			continue
+		case <-idleTimer.C:
+		}
+
+		if _, ok := f.AdvanceToNext(); !ok {
+			// nothing to advance to until a waiter is registered
+			select {
+			case <-stopCh:
+				return
+			case <-changed:
+			}
+		}
+	}
 }
 
 func (f *FakeClock) NewTimer(d time.Duration) Timer {
@@ -141,7 +495,24 @@ func (f *FakeClock) NewTimer(d time.Duration) Timer {
 			destChan:   ch,
 		},
 	}
-	f.waiters = append(f.waiters, timer.waiter)
+	f.addWaiterLocked(timer.waiter)
+	return timer
+}
+
+// AfterFunc calls fn once the fake time passes d from now. fn is called by
+// the Step or SetTime which moved the clock, before it returns and without
+// the clock locked. The returned Timer can stop it.
+func (f *FakeClock) AfterFunc(d time.Duration, fn func()) Timer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	timer := &fakeTimer{
+		fakeClock: f,
+		waiter: &fakeClockWaiter{
+			targetTime: f.time.Add(d),
+			afterFunc:  fn,
+		},
+	}
+	f.addWaiterLocked(timer.waiter)
 	return timer
 }
 
@@ -150,22 +521,17 @@ func (f *FakeClock) NewTicker(d time.Duration) Ticker {
 	defer f.lock.Unlock()
 	tickTime := f.time.Add(d)
 	ch := make(chan time.Time, 1)
-	f.waiters = append(f.waiters, &fakeClockWaiter{
-		targetTime:    tickTime,
-		stepInterval:  d,
-		skipIfBlocked: true,
-		destChan:      ch,
-	})
-
-	return &fakeTicker{
-		c: ch,
+	ticker := &fakeTicker{
+		fakeClock: f,
+		waiter: &fakeClockWaiter{
+			targetTime:    tickTime,
+			stepInterval:  d,
+			skipIfBlocked: true,
+			destChan:      ch,
+		},
 	}
-}
-
-type Timer interface {
-	C() <-chan time.Time
-	Stop() bool
-	Reset(d time.Duration) bool
+	f.addWaiterLocked(ticker.waiter)
+	return ticker
 }
 
 var (
@@ -183,49 +549,63 @@ func (f *fakeTimer) C() <-chan time.Time {
 }
 
 // Stop stops the timer and returns true if the timer has not yet fired, or false otherwise.
+// A value sent before Stop and not received yet is discarded, no stale value can be received
+// after Stop returns.
 func (f *fakeTimer) Stop() bool {
 	f.fakeClock.lock.Lock()
 	defer f.fakeClock.lock.Unlock()
 
-	newWaiters := make([]*fakeClockWaiter, 0, len(f.fakeClock.waiters))
-	for i := range f.fakeClock.waiters {
-		w := f.fakeClock.waiters[i]
-		if w != f.waiter {
-			newWaiters = append(newWaiters, w)
-		}
-	}
-
-	f.fakeClock.waiters = newWaiters
+	active := f.fakeClock.hasWaiterLocked(f.waiter)
+	f.fakeClock.removeWaiterLocked(f.waiter)
+	f.waiter.drain()
 
-	return !f.waiter.fired
+	return active
 }
 
-// Reset resets the timer to the fake clock's "now" + d. It returns true if the timer has not yet
-// fired, or false otherwise.
+// Reset resets the timer to the fake clock's "now" + d, even if it has already fired or been
+// stopped. It returns true if the timer has not yet fired, or false otherwise. Like Stop, it
+// discards a stale value not received yet.
 func (f *fakeTimer) Reset(d time.Duration) bool {
 	f.fakeClock.lock.Lock()
 	defer f.fakeClock.lock.Unlock()
 
-	active := !f.waiter.fired
-
-	f.waiter.fired = false
-	f.waiter.targetTime = f.fakeClock.time.Add(d)
+	active := f.fakeClock.hasWaiterLocked(f.waiter)
+	f.waiter.drain()
+	f.fakeClock.rescheduleWaiterLocked(f.waiter, f.fakeClock.time.Add(d))
 
 	return active
 }
 
-type Ticker interface {
-	C() <-chan time.Time
-	Stop()
-}
-
 type fakeTicker struct {
-	c <-chan time.Time
+	fakeClock *FakeClock
+	waiter    *fakeClockWaiter
 }
 
 func (t *fakeTicker) C() <-chan time.Time {
-	return t.c
+	return t.waiter.destChan
 }
 
+// Stop turns off the ticker, no more ticks will be sent and a tick not
+// received yet is discarded.
 func (t *fakeTicker) Stop() {
+	t.fakeClock.lock.Lock()
+	defer t.fakeClock.lock.Unlock()
+
+	t.fakeClock.removeWaiterLocked(t.waiter)
+	t.waiter.drain()
+}
+
+// Reset stops the ticker and resets its period to d, the next tick arrives
+// once the fake time passes d from now.
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+
+	t.fakeClock.lock.Lock()
+	defer t.fakeClock.lock.Unlock()
+
+	t.waiter.stepInterval = d
+	t.waiter.drain()
+	t.fakeClock.rescheduleWaiterLocked(t.waiter, t.fakeClock.time.Add(d))
 }
@@ -1,6 +1,8 @@
 package clock
 
 import (
+	"context"
+	"sync"
 	"testing"
 	"time"
 )
@@ -166,3 +168,428 @@ func TestFakeTick(t *testing.T) {
 		t.Errorf("unexpected number of accumulated ticks: %d", accumulatedTicks)
 	}
 }
+
+func TestFakeAfterFunc(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	called := make(chan struct{})
+	tc.AfterFunc(time.Second, func() { close(called) })
+	stopped := tc.AfterFunc(time.Second, func() { t.Errorf("unexpected call of a stopped AfterFunc") })
+	if !stopped.Stop() {
+		t.Errorf("expected Stop of a pending AfterFunc to return true")
+	}
+
+	tc.Step(999 * time.Millisecond)
+	select {
+	case <-called:
+		t.Errorf("unexpected call before the duration elapsed")
+	default:
+	}
+
+	tc.Step(time.Millisecond)
+	select {
+	case <-called:
+	default:
+		t.Errorf("expected the function to be called before Step returned")
+	}
+	if tc.HasWaiters() {
+		t.Errorf("unexpected waiter after AfterFunc fired")
+	}
+}
+
+func TestFakeAfterFuncUsingClock(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	var firedAt time.Time
+	tc.AfterFunc(time.Second, func() {
+		firedAt = tc.Now()
+		tc.AfterFunc(time.Second, func() {})
+	})
+
+	tc.SetTime(tc.Now().Add(time.Second))
+	if e, a := tc.Now(), firedAt; !e.Equal(a) {
+		t.Errorf("expected the function to see time %v, got %v", e, a)
+	}
+	if !tc.HasWaiters() {
+		t.Errorf("expected the AfterFunc registered by the function to be waiting")
+	}
+}
+
+func TestFakeTickerStop(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	ticker := tc.NewTicker(time.Second)
+	ticker.Stop()
+	if tc.HasWaiters() {
+		t.Errorf("unexpected waiter after Stop")
+	}
+
+	tc.Step(time.Second)
+	select {
+	case <-ticker.C():
+		t.Errorf("unexpected tick after Stop")
+	default:
+	}
+}
+
+func TestFakeTickerReset(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	ticker := tc.NewTicker(time.Second)
+	tc.Step(500 * time.Millisecond)
+	ticker.Reset(2 * time.Second)
+
+	tc.Step(time.Second)
+	select {
+	case <-ticker.C():
+		t.Errorf("unexpected tick before the new period elapsed")
+	default:
+	}
+
+	tc.Step(time.Second)
+	select {
+	case <-ticker.C():
+	default:
+		t.Errorf("expected a tick once the new period elapsed")
+	}
+
+	ticker.Stop()
+	ticker.Reset(time.Second)
+	if !tc.HasWaiters() {
+		t.Errorf("expected Reset to register a stopped ticker again")
+	}
+	tc.Step(time.Second)
+	select {
+	case <-ticker.C():
+	default:
+		t.Errorf("expected a tick from a ticker reset after Stop")
+	}
+}
+
+func TestFakeClockBlockUntil(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	fired := make(chan struct{})
+	go func() {
+		<-tc.After(time.Second)
+		close(fired)
+	}()
+
+	tc.BlockUntil(1)
+	if e, a := 1, tc.Waiters(); e != a {
+		t.Errorf("expected %v waiters, got %v", e, a)
+	}
+	tc.Step(time.Second)
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Errorf("expected the waiter to fire")
+	}
+	if e, a := 0, tc.Waiters(); e != a {
+		t.Errorf("expected %v waiters, got %v", e, a)
+	}
+}
+
+func TestFakeClockWaitForWaiters(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	tc.NewTimer(time.Second)
+
+	if err := tc.WaitForWaiters(context.Background(), 1); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if e, a := context.DeadlineExceeded, tc.WaitForWaiters(ctx, 2); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func TestFakeClockAdvanceToNext(t *testing.T) {
+	startTime := time.Now()
+	tc := NewFakeClock(startTime)
+	if _, ok := tc.AdvanceToNext(); ok {
+		t.Errorf("unexpected advance without waiters")
+	}
+
+	twoSec := tc.After(2 * time.Second)
+	oneSec := tc.After(time.Second)
+
+	now, ok := tc.AdvanceToNext()
+	if !ok {
+		t.Fatalf("expected an advance")
+	}
+	if e, a := startTime.Add(time.Second), now; !e.Equal(a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	select {
+	case <-oneSec:
+	default:
+		t.Errorf("expected the earliest waiter to fire")
+	}
+	select {
+	case <-twoSec:
+		t.Errorf("unexpected channel read")
+	default:
+	}
+
+	now, _ = tc.AdvanceToNext()
+	if e, a := startTime.Add(2*time.Second), now; !e.Equal(a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	select {
+	case <-twoSec:
+	default:
+		t.Errorf("expected the last waiter to fire")
+	}
+}
+
+func TestFakeClockAutoAdvance(t *testing.T) {
+	startTime := time.Now()
+	tc := NewFakeClock(startTime)
+	stop := tc.StartAutoAdvance(10 * time.Millisecond)
+	defer stop()
+
+	done := make(chan time.Time, 2)
+	for _, d := range []time.Duration{time.Hour, 90 * time.Minute} {
+		go func(d time.Duration) {
+			for i := 0; i < 3; i++ {
+				tc.Sleep(d)
+			}
+			done <- tc.Now()
+		}(d)
+	}
+
+	var finished []time.Time
+	for i := 0; i < 2; i++ {
+		select {
+		case now := <-done:
+			finished = append(finished, now)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("simulation didn't finish")
+		}
+	}
+	if e, a := startTime.Add(3*time.Hour), finished[0]; !e.Equal(a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if e, a := startTime.Add(270*time.Minute), finished[1]; !e.Equal(a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func TestFakeClockFiresInTimeOrder(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	var fired []int
+	for _, i := range []int{3, 1, 4, 0, 2} {
+		i := i
+		tc.AfterFunc(time.Duration(i)*time.Second, func() { fired = append(fired, i) })
+	}
+	// same target time as 1, registered later
+	tc.AfterFunc(time.Second, func() { fired = append(fired, 5) })
+
+	tc.Step(10 * time.Second)
+	expected := []int{0, 1, 5, 2, 3, 4}
+	if len(fired) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, fired)
+	}
+	for i := range expected {
+		if expected[i] != fired[i] {
+			t.Fatalf("expected %v, got %v", expected, fired)
+		}
+	}
+}
+
+func TestFakeClockManyTimers(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	const n = 10000
+	timers := make([]Timer, n)
+	for i := 0; i < n; i++ {
+		timers[i] = tc.NewTimer(time.Duration(n-i) * time.Millisecond)
+	}
+	// stop every other timer, out of order
+	for i := 0; i < n; i += 2 {
+		timers[i].Stop()
+	}
+	if e, a := n/2, tc.Waiters(); e != a {
+		t.Errorf("expected %v waiters, got %v", e, a)
+	}
+
+	tc.Step(n / 2 * time.Millisecond)
+	for i := 0; i < n; i++ {
+		fired := false
+		select {
+		case <-timers[i].C():
+			fired = true
+		default:
+		}
+		if e := i%2 == 1 && n-i <= n/2; e != fired {
+			t.Fatalf("timer %d: expected fired %v, got %v", i, e, fired)
+		}
+	}
+	if e, a := n/4, tc.Waiters(); e != a {
+		t.Errorf("expected %v waiters, got %v", e, a)
+	}
+}
+
+func TestFakeTimerResetAfterFire(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	timer := tc.NewTimer(time.Second)
+	tc.Step(time.Second)
+
+	// the first value is never received
+	if timer.Reset(time.Second) {
+		t.Errorf("expected Reset of a fired timer to return false")
+	}
+	select {
+	case <-timer.C():
+		t.Errorf("unexpected stale value after Reset")
+	default:
+	}
+
+	done := make(chan struct{})
+	go func() {
+		tc.Step(time.Second)
+		tc.Step(time.Second)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Step blocked on a timer nobody received from")
+	}
+
+	select {
+	case now := <-timer.C():
+		if e := tc.Now().Add(-time.Second); !e.Equal(now) {
+			t.Errorf("expected %v, got %v", e, now)
+		}
+	default:
+		t.Errorf("expected the reset timer to fire")
+	}
+	if tc.HasWaiters() {
+		t.Errorf("unexpected waiter after the reset timer fired")
+	}
+}
+
+func TestFakeTimerStopDrains(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	timer := tc.NewTimer(time.Second)
+	tc.Step(time.Second)
+	if timer.Stop() {
+		t.Errorf("expected Stop of a fired timer to return false")
+	}
+	select {
+	case <-timer.C():
+		t.Errorf("unexpected stale value after Stop")
+	default:
+	}
+
+	timer = tc.NewTimer(time.Second)
+	if !timer.Stop() {
+		t.Errorf("expected Stop of a pending timer to return true")
+	}
+	if timer.Reset(time.Second) {
+		t.Errorf("expected Reset of a stopped timer to return false")
+	}
+	tc.Step(time.Second)
+	select {
+	case <-timer.C():
+	default:
+		t.Errorf("expected a timer reset after Stop to fire")
+	}
+}
+
+func TestFakeClockConcurrentStep(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	timer := tc.NewTimer(time.Millisecond)
+	ticker := tc.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.Step(time.Millisecond)
+				timer.Reset(time.Millisecond)
+				tc.After(time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	tc.Step(time.Millisecond)
+	select {
+	case <-timer.C():
+	default:
+		t.Errorf("expected the timer to fire")
+	}
+}
+
+func TestFakeClockWallJump(t *testing.T) {
+	startTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tc := NewFakeClock(startTime)
+	timer := tc.NewTimer(time.Minute)
+	start := tc.Now()
+
+	// NTP moves the wall clock back
+	tc.StepWall(-time.Hour)
+	if e, a := startTime.Add(-time.Hour), tc.Now(); !e.Equal(a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if e, a := time.Duration(0), tc.Since(start); e != a {
+		t.Errorf("expected Since %v, got %v", e, a)
+	}
+
+	tc.Step(30 * time.Second)
+	afterJump := tc.Now()
+	tc.SetWallTime(startTime.Add(time.Hour))
+	if e, a := startTime.Add(time.Hour), tc.Now(); !e.Equal(a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	select {
+	case <-timer.C():
+		t.Errorf("unexpected fire on a wall clock jump")
+	default:
+	}
+
+	tc.Step(30 * time.Second)
+	select {
+	case now := <-timer.C():
+		if e := startTime.Add(time.Hour + 30*time.Second); !e.Equal(now) {
+			t.Errorf("expected the timer to send the wall time %v, got %v", e, now)
+		}
+	default:
+		t.Errorf("expected the timer to fire once the monotonic time elapsed")
+	}
+	if e, a := time.Minute, tc.Since(start); e != a {
+		t.Errorf("expected Since %v, got %v", e, a)
+	}
+	if e, a := 30*time.Second, tc.Since(afterJump); e != a {
+		t.Errorf("expected Since %v, got %v", e, a)
+	}
+
+	// moves both clocks
+	tc.SetTime(tc.Now().Add(time.Minute))
+	if e, a := 2*time.Minute, tc.Since(start); e != a {
+		t.Errorf("expected Since %v, got %v", e, a)
+	}
+}
+
+func TestFakeClockLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	// an hour before daylight saving time starts
+	tc := NewFakeClock(time.Date(2021, 3, 14, 6, 0, 0, 0, time.UTC))
+	tc.SetLocation(loc)
+	if e, a := 1, tc.Now().Hour(); e != a {
+		t.Errorf("expected hour %v, got %v", e, a)
+	}
+
+	start := tc.Now()
+	tc.Step(time.Hour)
+	if e, a := 3, tc.Now().Hour(); e != a {
+		t.Errorf("expected hour %v, got %v", e, a)
+	}
+	if e, a := time.Hour, tc.Since(start); e != a {
+		t.Errorf("expected Since %v, got %v", e, a)
+	}
+}
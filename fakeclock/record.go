@@ -0,0 +1,569 @@
+package clock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TraceOp is a call to a Clock, Timer or Ticker recorded in a trace.
+type TraceOp string
+
+const (
+	TraceNow         TraceOp = "now"
+	TraceSince       TraceOp = "since"
+	TraceAfter       TraceOp = "after"
+	TraceNewTimer    TraceOp = "newTimer"
+	TraceAfterFunc   TraceOp = "afterFunc"
+	TraceNewTicker   TraceOp = "newTicker"
+	TraceSleep       TraceOp = "sleep"
+	TraceTimerStop   TraceOp = "timerStop"
+	TraceTimerReset  TraceOp = "timerReset"
+	TraceTickerStop  TraceOp = "tickerStop"
+	TraceTickerReset TraceOp = "tickerReset"
+	// TraceFire is not a call but the firing of a timer or ticker
+	TraceFire TraceOp = "fire"
+)
+
+// TraceEvent records a call, or the firing of a timer or ticker, encoded to
+// JSON.
+type TraceEvent struct {
+	Op TraceOp `json:"op"`
+	// At is the time of the clock when the call was made, or the time sent
+	// by the timer or ticker which fired
+	At time.Time `json:"at"`
+	// ID identifies the timer or ticker created, used or fired, in the order
+	// they were created, starting from 1
+	ID int `json:"id,omitempty"`
+	// Duration is the duration passed to the call, if any
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+func (e TraceEvent) String() string {
+	return fmt.Sprintf("%s(id=%d, d=%s) at %s", e.Op, e.ID, e.Duration, e.At.Format(time.RFC3339Nano))
+}
+
+// RecordingClock is a Clock which records every call made to it, and to the
+// timers and tickers it creates, in a trace which can be replayed by a
+// ReplayClock. The firings of the timers and tickers are recorded too: their
+// channels are fed by a goroutine which records the value it receives before
+// passing it on.
+type RecordingClock struct {
+	clock Clock
+
+	lock   sync.Mutex
+	trace  []TraceEvent
+	lastID int
+}
+
+var _ Clock = &RecordingClock{}
+
+// NewRecordingClock returns a RecordingClock which delegates to clock,
+// usually a RealClock.
+func NewRecordingClock(clock Clock) *RecordingClock {
+	return &RecordingClock{
+		clock: clock,
+	}
+}
+
+// Trace returns the events recorded so far, in order.
+func (r *RecordingClock) Trace() []TraceEvent {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	trace := make([]TraceEvent, len(r.trace))
+	copy(trace, r.trace)
+	return trace
+}
+
+// record appends a call at the current time, newID gives it the ID of a new
+// timer or ticker. It returns the ID of the call.
+func (r *RecordingClock) record(op TraceOp, id int, d time.Duration, newID bool) (time.Time, int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := r.clock.Now()
+	if newID {
+		r.lastID++
+		id = r.lastID
+	}
+	r.trace = append(r.trace, TraceEvent{Op: op, At: now, ID: id, Duration: d})
+	return now, id
+}
+
+// recordFire appends the firing of timer or ticker id at at.
+func (r *RecordingClock) recordFire(id int, at time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.trace = append(r.trace, TraceEvent{Op: TraceFire, At: at, ID: id})
+}
+
+func (r *RecordingClock) Now() time.Time {
+	now, _ := r.record(TraceNow, 0, 0, false)
+	return now
+}
+
+func (r *RecordingClock) Since(ts time.Time) time.Duration {
+	r.record(TraceSince, 0, 0, false)
+	return r.clock.Since(ts)
+}
+
+func (r *RecordingClock) After(d time.Duration) <-chan time.Time {
+	_, id := r.record(TraceAfter, 0, d, true)
+	w := newRecordingWaiter(r, id, false)
+	w.start(r.clock.After(d))
+	return w.c
+}
+
+func (r *RecordingClock) NewTimer(d time.Duration) Timer {
+	_, id := r.record(TraceNewTimer, 0, d, true)
+	t := &recordingTimer{
+		recordingWaiter: newRecordingWaiter(r, id, false),
+		timer:           r.clock.NewTimer(d),
+	}
+	t.start(t.timer.C())
+	return t
+}
+
+func (r *RecordingClock) AfterFunc(d time.Duration, f func()) Timer {
+	_, id := r.record(TraceAfterFunc, 0, d, true)
+	return &recordingTimer{
+		recordingWaiter: newRecordingWaiter(r, id, false),
+		timer: r.clock.AfterFunc(d, func() {
+			r.recordFire(id, r.clock.Now())
+			f()
+		}),
+		afterFunc: true,
+	}
+}
+
+func (r *RecordingClock) NewTicker(d time.Duration) Ticker {
+	_, id := r.record(TraceNewTicker, 0, d, true)
+	t := &recordingTicker{
+		recordingWaiter: newRecordingWaiter(r, id, true),
+		ticker:          r.clock.NewTicker(d),
+	}
+	t.start(t.ticker.C())
+	return t
+}
+
+func (r *RecordingClock) Sleep(d time.Duration) {
+	r.record(TraceSleep, 0, d, false)
+	r.clock.Sleep(d)
+}
+
+// recordingWaiter passes on the values sent on the channel of a timer or
+// ticker of the recorded clock, after recording them.
+type recordingWaiter struct {
+	clock *RecordingClock
+	id    int
+	// ticker makes the values sent when c is full dropped, rather than
+	// replacing the one in c, and keeps forwarding after the first one
+	ticker bool
+	c      chan time.Time
+
+	// lock serializes starting and stopping the forwarding goroutine
+	lock sync.Mutex
+	// quit is closed to stop the forwarding goroutine, nil if it isn't
+	// running
+	quit chan struct{}
+	// done is closed once the forwarding goroutine returned
+	done chan struct{}
+}
+
+func newRecordingWaiter(clock *RecordingClock, id int, ticker bool) *recordingWaiter {
+	return &recordingWaiter{
+		clock:  clock,
+		id:     id,
+		ticker: ticker,
+		c:      make(chan time.Time, 1),
+	}
+}
+
+// C returns the channel fed with the recorded values.
+func (w *recordingWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+// start starts forwarding the values sent on src. w.lock must be held,
+// unless w isn't shared yet.
+func (w *recordingWaiter) start(src <-chan time.Time) {
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	w.quit = quit
+	w.done = done
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case now := <-src:
+				w.clock.recordFire(w.id, now)
+				w.deliver(now)
+				if !w.ticker {
+					return
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// deliver sends t on w.c without blocking, as FakeClock does.
+func (w *recordingWaiter) deliver(t time.Time) {
+	for {
+		select {
+		case w.c <- t:
+			return
+		default:
+		}
+		if w.ticker {
+			return
+		}
+		select {
+		case <-w.c:
+		default:
+		}
+	}
+}
+
+// stop stops forwarding values and discards a value not received yet.
+// w.lock must be held.
+func (w *recordingWaiter) stop() {
+	if w.quit != nil {
+		close(w.quit)
+		<-w.done
+		w.quit = nil
+	}
+	select {
+	case <-w.c:
+	default:
+	}
+}
+
+type recordingTimer struct {
+	*recordingWaiter
+	timer Timer
+	// afterFunc timers have no channel
+	afterFunc bool
+}
+
+func (t *recordingTimer) C() <-chan time.Time {
+	if t.afterFunc {
+		return nil
+	}
+	return t.c
+}
+
+func (t *recordingTimer) Stop() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.clock.record(TraceTimerStop, t.id, 0, false)
+	active := t.timer.Stop()
+	t.stop()
+	return active
+}
+
+func (t *recordingTimer) Reset(d time.Duration) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.clock.record(TraceTimerReset, t.id, d, false)
+	t.stop()
+	active := t.timer.Reset(d)
+	if !t.afterFunc {
+		t.start(t.timer.C())
+	}
+	return active
+}
+
+type recordingTicker struct {
+	*recordingWaiter
+	ticker Ticker
+}
+
+func (t *recordingTicker) Stop() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.clock.record(TraceTickerStop, t.id, 0, false)
+	t.ticker.Stop()
+	t.stop()
+}
+
+func (t *recordingTicker) Reset(d time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.clock.record(TraceTickerReset, t.id, d, false)
+	t.stop()
+	t.ticker.Reset(d)
+	t.start(t.ticker.C())
+}
+
+// ReplayClock is a Clock which replays a trace recorded by a RecordingClock
+// on a FakeClock: before each call is served by the FakeClock, it is moved
+// to the time the call was recorded at. The recorded firings are replayed by
+// a goroutine which moves the FakeClock to their time once the timer or
+// ticker which fired is created and the previous value sent on its channel
+// has been received, so that code blocked on a channel gets it. The firings
+// recorded before a call are replayed when the call is made, if the
+// goroutine hasn't done it yet.
+//
+// The calls have to be made in the recorded order, which is only
+// deterministic if the code under test doesn't race on the clock. The first
+// call which doesn't match the trace is reported by Err, the calls after it
+// and after the end of the trace don't move the FakeClock anymore.
+type ReplayClock struct {
+	fakeClock *FakeClock
+
+	lock   sync.Mutex
+	trace  []TraceEvent
+	next   int
+	lastID int
+	err    error
+	// channels holds the channel of every timer and ticker created so far
+	// by ID, nil for AfterFunc
+	channels map[int]<-chan time.Time
+	// changed is closed and replaced whenever next or channels changes
+	changed chan struct{}
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+var _ Clock = &ReplayClock{}
+
+// replayPollInterval is how often the goroutine replaying the firings checks
+// whether a value sent on a channel has been received.
+const replayPollInterval = time.Millisecond
+
+// NewReplayClock returns a ReplayClock replaying trace on fakeClock, which
+// is usually created at the time of the first event of trace. The goroutine
+// replaying the firings returns at the end of trace, or once Stop is called.
+func NewReplayClock(fakeClock *FakeClock, trace []TraceEvent) *ReplayClock {
+	r := &ReplayClock{
+		fakeClock: fakeClock,
+		trace:     trace,
+		channels:  map[int]<-chan time.Time{},
+		stopCh:    make(chan struct{}),
+	}
+	go r.replayFires()
+	return r
+}
+
+// Stop stops replaying the firings.
+func (r *ReplayClock) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+}
+
+// Err returns the error describing the first call which didn't match the
+// trace, if any.
+func (r *ReplayClock) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// Remaining returns the number of events of the trace which haven't been
+// replayed yet.
+func (r *ReplayClock) Remaining() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.trace) - r.next
+}
+
+// changedLocked returns a channel closed once next or channels changes. r
+// must be locked.
+func (r *ReplayClock) changedLocked() <-chan struct{} {
+	if r.changed == nil {
+		r.changed = make(chan struct{})
+	}
+	return r.changed
+}
+
+// notifyChangedLocked wakes up replayFires. r must be locked.
+func (r *ReplayClock) notifyChangedLocked() {
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+}
+
+// moveTo moves the FakeClock to at, unless it is already past it. r must
+// not be locked, the functions of AfterFunc the FakeClock runs may call r.
+func (r *ReplayClock) moveTo(at time.Time) {
+	if at.After(r.fakeClock.Now()) {
+		r.fakeClock.SetTime(at)
+	}
+}
+
+// replay matches a call with the next event of the trace, after replaying
+// the firings recorded before it, and moves the FakeClock to its time. newID
+// gives the call the ID of a new timer or ticker. It returns the ID of the
+// call.
+func (r *ReplayClock) replay(op TraceOp, id int, d time.Duration, newID bool) int {
+	r.lock.Lock()
+	if newID {
+		r.lastID++
+		id = r.lastID
+	}
+	for r.err == nil && r.next < len(r.trace) {
+		event := r.trace[r.next]
+		r.next++
+		r.notifyChangedLocked()
+
+		if event.Op == TraceFire {
+			r.lock.Unlock()
+			r.moveTo(event.At)
+			r.lock.Lock()
+			continue
+		}
+
+		if event.Op != op || event.ID != id || event.Duration != d {
+			r.err = fmt.Errorf("event %d: expected %s, got %s(id=%d, d=%s)", r.next, event, op, id, d)
+			break
+		}
+		r.lock.Unlock()
+		r.moveTo(event.At)
+		return id
+	}
+	r.lock.Unlock()
+	return id
+}
+
+// register records the channel of the timer or ticker id once it has been
+// created on the FakeClock, so that its firings can be replayed.
+func (r *ReplayClock) register(id int, c <-chan time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.channels[id] = c
+	r.notifyChangedLocked()
+}
+
+// replayFires replays the firings when the next event of the trace is one,
+// until the end of the trace or Stop.
+func (r *ReplayClock) replayFires() {
+	for {
+		r.lock.Lock()
+		if r.err != nil || r.next >= len(r.trace) {
+			r.lock.Unlock()
+			return
+		}
+		event := r.trace[r.next]
+		changed := r.changedLocked()
+		registered, received := false, false
+		if event.Op == TraceFire {
+			var c <-chan time.Time
+			c, registered = r.channels[event.ID]
+			received = len(c) == 0
+		}
+		if registered && received {
+			r.next++
+			r.notifyChangedLocked()
+		}
+		r.lock.Unlock()
+
+		if registered && received {
+			r.moveTo(event.At)
+			continue
+		}
+
+		// receiving from a channel doesn't notify us, poll it
+		var poll <-chan time.Time
+		if registered {
+			poll = time.After(replayPollInterval)
+		}
+		select {
+		case <-r.stopCh:
+			return
+		case <-changed:
+		case <-poll:
+		}
+	}
+}
+
+func (r *ReplayClock) Now() time.Time {
+	r.replay(TraceNow, 0, 0, false)
+	return r.fakeClock.Now()
+}
+
+func (r *ReplayClock) Since(ts time.Time) time.Duration {
+	r.replay(TraceSince, 0, 0, false)
+	return r.fakeClock.Since(ts)
+}
+
+func (r *ReplayClock) After(d time.Duration) <-chan time.Time {
+	id := r.replay(TraceAfter, 0, d, true)
+	c := r.fakeClock.After(d)
+	r.register(id, c)
+	return c
+}
+
+func (r *ReplayClock) NewTimer(d time.Duration) Timer {
+	id := r.replay(TraceNewTimer, 0, d, true)
+	t := &replayTimer{
+		Timer: r.fakeClock.NewTimer(d),
+		clock: r,
+		id:    id,
+	}
+	r.register(id, t.C())
+	return t
+}
+
+func (r *ReplayClock) AfterFunc(d time.Duration, f func()) Timer {
+	id := r.replay(TraceAfterFunc, 0, d, true)
+	t := &replayTimer{
+		Timer: r.fakeClock.AfterFunc(d, f),
+		clock: r,
+		id:    id,
+	}
+	r.register(id, nil)
+	return t
+}
+
+func (r *ReplayClock) NewTicker(d time.Duration) Ticker {
+	id := r.replay(TraceNewTicker, 0, d, true)
+	t := &replayTicker{
+		Ticker: r.fakeClock.NewTicker(d),
+		clock:  r,
+		id:     id,
+	}
+	r.register(id, t.C())
+	return t
+}
+
+// Sleep returns once the FakeClock has been moved to the time of the call,
+// the time slept is covered by the time of the next call.
+func (r *ReplayClock) Sleep(d time.Duration) {
+	r.replay(TraceSleep, 0, d, false)
+}
+
+type replayTimer struct {
+	Timer
+	clock *ReplayClock
+	id    int
+}
+
+func (t *replayTimer) Stop() bool {
+	t.clock.replay(TraceTimerStop, t.id, 0, false)
+	return t.Timer.Stop()
+}
+
+func (t *replayTimer) Reset(d time.Duration) bool {
+	t.clock.replay(TraceTimerReset, t.id, d, false)
+	return t.Timer.Reset(d)
+}
+
+type replayTicker struct {
+	Ticker
+	clock *ReplayClock
+	id    int
+}
+
+func (t *replayTicker) Stop() {
+	t.clock.replay(TraceTickerStop, t.id, 0, false)
+	t.Ticker.Stop()
+}
+
+func (t *replayTicker) Reset(d time.Duration) {
+	t.clock.replay(TraceTickerReset, t.id, d, false)
+	t.Ticker.Reset(d)
+}
@@ -0,0 +1,130 @@
+package clock
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// runSchedule makes calls to c and blocks on the timers and tickers it
+// creates.
+func runSchedule(c Clock) []string {
+	var events []string
+	start := c.Now()
+	fired := make(chan string, 1)
+	c.AfterFunc(time.Second, func() { fired <- "afterFunc" })
+	timer := c.NewTimer(2 * time.Second)
+	ticker := c.NewTicker(1500 * time.Millisecond)
+
+	events = append(events, <-fired)
+	<-ticker.C()
+	events = append(events, "tick "+c.Since(start).String())
+	<-ticker.C()
+	events = append(events, "tick "+c.Since(start).String())
+	<-timer.C()
+	events = append(events, "timer "+c.Since(start).String())
+	ticker.Stop()
+
+	<-c.After(time.Minute)
+	events = append(events, "now "+c.Now().Sub(start).String())
+	return events
+}
+
+func TestRecordReplay(t *testing.T) {
+	startTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	production := NewFakeClock(startTime)
+	stop := production.StartAutoAdvance(10 * time.Millisecond)
+	recorder := NewRecordingClock(production)
+	recorded := runSchedule(recorder)
+	stop()
+
+	data, err := json.Marshal(recorder.Trace())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var trace []TraceEvent
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	replayer := NewReplayClock(NewFakeClock(startTime), trace)
+	defer replayer.Stop()
+	replayed := make(chan []string, 1)
+	go func() {
+		replayed <- runSchedule(replayer)
+	}()
+	var events []string
+	select {
+	case events = <-replayed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("replay blocked with %v events remaining", replayer.Remaining())
+	}
+	if err := replayer.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if e, a := 0, replayer.Remaining(); e != a {
+		t.Errorf("expected %v remaining events, got %v", e, a)
+	}
+
+	expected := []string{"afterFunc", "tick 1.5s", "tick 3s", "timer 3s", "now 1m3s"}
+	if !reflect.DeepEqual(expected, recorded) {
+		t.Errorf("expected %v, got %v", expected, recorded)
+	}
+	if !reflect.DeepEqual(expected, events) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+}
+
+func TestReplayBlockingOnTimer(t *testing.T) {
+	startTime := time.Now()
+	production := NewFakeClock(startTime)
+	recorder := NewRecordingClock(production)
+	go func() {
+		production.BlockUntil(1)
+		production.Step(time.Second)
+	}()
+	<-recorder.After(time.Second)
+	recorder.Now()
+
+	replayer := NewReplayClock(NewFakeClock(startTime), recorder.Trace())
+	defer replayer.Stop()
+	done := make(chan time.Time, 1)
+	go func() {
+		<-replayer.After(time.Second)
+		done <- replayer.Now()
+	}()
+	select {
+	case now := <-done:
+		if e := startTime.Add(time.Second); !e.Equal(now) {
+			t.Errorf("expected %v, got %v", e, now)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("replay blocked with %v events remaining", replayer.Remaining())
+	}
+	if e, a := 0, replayer.Remaining(); e != a {
+		t.Errorf("expected %v remaining events, got %v", e, a)
+	}
+}
+
+func TestReplayDivergence(t *testing.T) {
+	startTime := time.Now()
+	production := NewFakeClock(startTime)
+	recorder := NewRecordingClock(production)
+	recorder.NewTimer(time.Second)
+	production.Step(time.Minute)
+	recorder.Now()
+
+	replayer := NewReplayClock(NewFakeClock(startTime), recorder.Trace())
+	defer replayer.Stop()
+	replayer.NewTimer(2 * time.Second)
+	if replayer.Err() == nil {
+		t.Errorf("expected an error for a call with another duration")
+	}
+
+	// the FakeClock isn't moved anymore
+	now := replayer.Now()
+	if e, a := startTime, now; !e.Equal(a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
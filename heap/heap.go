@@ -29,8 +29,12 @@ func Push(h Interface, x interface{}) {
 
 func Remove(h Interface, i int) interface{} {
 	n := h.Len() - 1
-	h.Swap(i, n)
-	down(h, i, n)
+	if n != i {
+		h.Swap(i, n)
+		if !down(h, i, n) {
+			up(h, i)
+		}
+	}
 	return h.Pop()
 }
 
@@ -181,6 +181,17 @@ func BenchmarkDup(b *testing.B) {
 	}
 }
 
+func TestRemoveUp(t *testing.T) {
+	// removing 11 moves 3 below 10, it has to go up
+	h := &myHeap{0, 10, 1, 11, 12, 2, 3}
+	h.verify(t, 0)
+
+	if x := Remove(h, 3).(int); x != 11 {
+		t.Errorf("Remove(3) got %d; want 11", x)
+	}
+	h.verify(t, 0)
+}
+
 func TestFix(t *testing.T) {
 	h := new(myHeap)
 	h.verify(t, 0)
@@ -0,0 +1,161 @@
+package workqueue
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrQueueFull is returned when an item can't be added to a bounded
+	// queue which is full.
+	ErrQueueFull = errors.New("workqueue: queue is full")
+
+	// ErrQueueShutDown is returned when an item is added to a bounded queue
+	// which is shutting down.
+	ErrQueueShutDown = errors.New("workqueue: queue is shutting down")
+)
+
+// OverflowPolicy tells what happens when an item is added to a full bounded
+// queue.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Add and AddWithContext wait for room.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject makes Add discard the item and AddWithContext return
+	// ErrQueueFull.
+	OverflowReject
+	// OverflowDrop makes Add and AddWithContext silently discard the item.
+	OverflowDrop
+)
+
+// BoundedQueueConfig is the interface{} flavour of TypedBoundedQueueConfig.
+type BoundedQueueConfig = TypedBoundedQueueConfig[interface{}]
+
+// TypedBoundedQueueConfig specifies the configuration of a bounded queue.
+type TypedBoundedQueueConfig[T comparable] struct {
+	TypedQueueConfig[T]
+
+	// MaxLength is the maximum number of items waiting to be processed,
+	// including the ones which are added again while processing. The queue
+	// is unbounded if MaxLength is not positive.
+	MaxLength int
+
+	// Overflow tells what happens when an item is added to a full queue.
+	Overflow OverflowPolicy
+}
+
+// BoundedType is the interface{} flavour of TypedBoundedType.
+type BoundedType = TypedBoundedType[interface{}]
+
+// TypedBoundedType is a work queue holding at most a maximum number of
+// items waiting to be processed. Adding an item which is already waiting
+// always succeeds, as it doesn't take any room.
+type TypedBoundedType[T comparable] struct {
+	*TypedType[T]
+
+	maxLength int
+	overflow  OverflowPolicy
+
+	// rejected counts the items which have not been added because the
+	// queue was full, under cond.L
+	rejected int
+}
+
+func NewBoundedQueue(maxLength int, overflow OverflowPolicy) *BoundedType {
+	return NewTypedBoundedQueueWithConfig(BoundedQueueConfig{
+		MaxLength: maxLength,
+		Overflow:  overflow,
+	})
+}
+
+func NewTypedBoundedQueueWithConfig[T comparable](config TypedBoundedQueueConfig[T]) *TypedBoundedType[T] {
+	return &TypedBoundedType[T]{
+		TypedType: NewTypedWithConfig(config.TypedQueueConfig),
+		maxLength: config.MaxLength,
+		overflow:  config.Overflow,
+	}
+}
+
+// hasRoom tells whether item can be added. q.cond.L must be held.
+func (q *TypedBoundedType[T]) hasRoom(item T) bool {
+	return q.maxLength <= 0 || q.dirty.has(item) || len(q.dirty) < q.maxLength
+}
+
+// Add adds item according to the overflow policy of the queue.
+func (q *TypedBoundedType[T]) Add(item T) {
+	q.AddWithContext(context.Background(), item)
+}
+
+// TryAdd adds item if there is room for it, otherwise it returns
+// ErrQueueFull whatever the overflow policy.
+func (q *TypedBoundedType[T]) TryAdd(item T) error {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if q.shuttingDown {
+		return ErrQueueShutDown
+	}
+	if !q.hasRoom(item) {
+		q.rejected++
+		return ErrQueueFull
+	}
+	q.addLocked(item)
+	return nil
+}
+
+// AddWithContext adds item according to the overflow policy of the queue.
+// With OverflowBlock, it returns ctx.Err() if ctx is done before there is
+// room for item.
+func (q *TypedBoundedType[T]) AddWithContext(ctx context.Context, item T) error {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if q.shuttingDown {
+		return ErrQueueShutDown
+	}
+	if q.hasRoom(item) {
+		q.addLocked(item)
+		return nil
+	}
+
+	switch q.overflow {
+	case OverflowReject:
+		q.rejected++
+		return ErrQueueFull
+	case OverflowDrop:
+		q.rejected++
+		return nil
+	}
+
+	// as in GetWithContext, a producer woken up by Signal finds room and
+	// uses it before looking at ctx, so that no Signal is lost
+	stop := context.AfterFunc(ctx, func() {
+		q.cond.L.Lock()
+		defer q.cond.L.Unlock()
+		q.space.Broadcast()
+	})
+	defer stop()
+
+	for !q.hasRoom(item) && !q.shuttingDown && ctx.Err() == nil {
+		q.space.Wait()
+	}
+
+	if q.shuttingDown {
+		return ErrQueueShutDown
+	}
+	if !q.hasRoom(item) {
+		q.rejected++
+		return ctx.Err()
+	}
+	q.addLocked(item)
+	return nil
+}
+
+// Rejected returns how many items have not been added because the queue
+// was full.
+func (q *TypedBoundedType[T]) Rejected() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.rejected
+}
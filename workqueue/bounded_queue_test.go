@@ -0,0 +1,168 @@
+package workqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBoundedQueueReject(t *testing.T) {
+	q := NewBoundedQueue(2, OverflowReject)
+	defer q.ShutDown()
+
+	if err := q.TryAdd("foo"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := q.AddWithContext(context.Background(), "bar"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	// a waiting item doesn't take more room
+	if err := q.TryAdd("foo"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := q.AddWithContext(context.Background(), "baz"); err != ErrQueueFull {
+		t.Errorf("Expected %v, got %v", ErrQueueFull, err)
+	}
+	q.Add("baz")
+	if e, a := 2, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	if e, a := 2, q.Rejected(); e != a {
+		t.Errorf("Expected %v rejected items, got %v", e, a)
+	}
+
+	// an item added again while processing takes room until it is done
+	foo, _ := q.Get()
+	q.Add(foo)
+	if err := q.TryAdd("baz"); err != ErrQueueFull {
+		t.Errorf("Expected %v, got %v", ErrQueueFull, err)
+	}
+	q.Done(foo)
+	q.Get()
+	if err := q.TryAdd("baz"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestBoundedQueueDrop(t *testing.T) {
+	q := NewBoundedQueue(1, OverflowDrop)
+	defer q.ShutDown()
+
+	q.Add("foo")
+	if err := q.AddWithContext(context.Background(), "bar"); err != nil {
+		t.Errorf("Expected the item to be dropped silently, got %v", err)
+	}
+	if err := q.TryAdd("bar"); err != ErrQueueFull {
+		t.Errorf("Expected %v, got %v", ErrQueueFull, err)
+	}
+	if e, a := 1, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	if e, a := 2, q.Rejected(); e != a {
+		t.Errorf("Expected %v rejected items, got %v", e, a)
+	}
+}
+
+func TestBoundedQueueUnbounded(t *testing.T) {
+	q := NewTypedBoundedQueueWithConfig(TypedBoundedQueueConfig[int]{})
+	defer q.ShutDown()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if err := q.TryAdd(i); err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+			q.Add(100 + i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a queue without MaxLength not to block")
+	}
+	if e, a := 200, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	if e, a := 0, q.Rejected(); e != a {
+		t.Errorf("Expected %v rejected items, got %v", e, a)
+	}
+}
+
+func TestBoundedQueueBlock(t *testing.T) {
+	q := NewTypedBoundedQueueWithConfig(TypedBoundedQueueConfig[int]{
+		MaxLength: 1,
+	})
+
+	q.Add(1)
+
+	added := make(chan struct{})
+	go func() {
+		q.Add(2)
+		close(added)
+	}()
+
+	select {
+	case <-added:
+		t.Fatalf("Expected Add to block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	item, _ := q.Get()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Add to return once there is room")
+	}
+	q.Done(item)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.AddWithContext(ctx, 3); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if e, a := 1, q.Rejected(); e != a {
+		t.Errorf("Expected %v rejected items, got %v", e, a)
+	}
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- q.AddWithContext(context.Background(), 4)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.ShutDown()
+	select {
+	case err := <-errCh:
+		if err != ErrQueueShutDown {
+			t.Errorf("Expected %v, got %v", ErrQueueShutDown, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected blocked producers to return on shutdown")
+	}
+}
+
+func TestBoundedQueueManyProducers(t *testing.T) {
+	q := NewTypedBoundedQueueWithConfig(TypedBoundedQueueConfig[int]{
+		MaxLength: 3,
+	})
+	defer q.ShutDown()
+
+	const items = 100
+	for i := 0; i < items; i++ {
+		go q.Add(i)
+	}
+
+	seen := map[int]bool{}
+	for len(seen) < items {
+		item, _, err := q.GetWithTimeout(time.Second)
+		if err != nil {
+			t.Fatalf("Only %v of %v items were added", len(seen), items)
+		}
+		if l := q.Len(); l > 3 {
+			t.Errorf("Queue holds %v items", l)
+		}
+		seen[item] = true
+		q.Done(item)
+	}
+}
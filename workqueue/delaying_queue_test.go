@@ -0,0 +1,170 @@
+package workqueue
+
+import (
+	"testing"
+	"time"
+
+	clock "github.com/YaoZengzeng/gok8s/fakeclock"
+)
+
+// waitForLen polls q until it holds n items or the timeout expires.
+func waitForLen(q interface{ Len() int }, n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if q.Len() == n {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return q.Len() == n
+}
+
+func TestSimpleQueue(t *testing.T) {
+	q := NewDelayingQueue()
+	defer q.ShutDown()
+
+	first := "foo"
+
+	q.AddAfter(first, 50*time.Millisecond)
+	if q.Len() != 0 {
+		t.Errorf("should not have added")
+	}
+
+	if !waitForLen(q, 1, time.Second) {
+		t.Fatalf("expected %v to be added after the delay", first)
+	}
+
+	item, _ := q.Get()
+	q.Done(item)
+	if item != first {
+		t.Errorf("expected %v, got %v", first, item)
+	}
+}
+
+func TestDelayingQueueWithFakeClock(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewDelayingQueueWithCustomClock(fakeClock, "")
+	defer q.ShutDown()
+
+	first := "foo"
+
+	q.AddAfter(first, time.Hour)
+	// the heartbeat and the timer of first
+	fakeClock.BlockUntil(2)
+	if q.Len() != 0 {
+		t.Errorf("should not have added before the fake clock moved")
+	}
+
+	fakeClock.Step(time.Hour)
+	if !waitForLen(q, 1, time.Second) {
+		t.Fatalf("expected %v to be added once the fake clock moved", first)
+	}
+}
+
+func TestDeduping(t *testing.T) {
+	q := NewDelayingQueue()
+	defer q.ShutDown()
+
+	first := "foo"
+
+	q.AddAfter(first, 50*time.Millisecond)
+	q.AddAfter(first, 70*time.Millisecond)
+	if !waitForLen(q, 1, time.Second) {
+		t.Fatalf("expected %v to be added once", first)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if q.Len() != 1 {
+		t.Errorf("expected a single item, got %v", q.Len())
+	}
+
+	item, _ := q.Get()
+	q.Done(item)
+
+	// the earlier ready time wins, even if it is registered second
+	q.AddAfter(first, time.Hour)
+	q.AddAfter(first, 20*time.Millisecond)
+	if !waitForLen(q, 1, time.Second) {
+		t.Fatalf("expected %v to be added at the earlier time", first)
+	}
+}
+
+func TestAddTwoFireEarly(t *testing.T) {
+	q := NewDelayingQueue()
+	defer q.ShutDown()
+
+	first := "foo"
+	second := "bar"
+	third := "baz"
+
+	q.AddAfter(first, time.Hour)
+	q.AddAfter(second, 20*time.Millisecond)
+	if !waitForLen(q, 1, time.Second) {
+		t.Fatalf("expected %v to be added", second)
+	}
+	item, _ := q.Get()
+	if item != second {
+		t.Errorf("expected %v, got %v", second, item)
+	}
+	q.Done(item)
+
+	q.AddAfter(third, 20*time.Millisecond)
+	if !waitForLen(q, 1, time.Second) {
+		t.Fatalf("expected %v to be added", third)
+	}
+	item, _ = q.Get()
+	if item != third {
+		t.Errorf("expected %v, got %v", third, item)
+	}
+	q.Done(item)
+}
+
+func TestAddAfterNonPositive(t *testing.T) {
+	q := NewDelayingQueue()
+	defer q.ShutDown()
+
+	q.AddAfter("foo", 0)
+	q.AddAfter("bar", -time.Second)
+	if q.Len() != 2 {
+		t.Errorf("expected items with no delay to be added immediately, got %v", q.Len())
+	}
+}
+
+func TestDelayingShutDown(t *testing.T) {
+	q := NewDelayingQueue()
+
+	q.AddAfter("foo", 20*time.Millisecond)
+	q.ShutDown()
+	// ShutDown may be invoked more than once
+	q.ShutDown()
+
+	q.AddAfter("bar", 0)
+	time.Sleep(50 * time.Millisecond)
+	if q.Len() != 0 {
+		t.Errorf("expected no items after shutdown, got %v", q.Len())
+	}
+
+	if _, shutdown := q.Get(); !shutdown {
+		t.Errorf("expected Get to report shutdown")
+	}
+}
+
+func TestDelayingShutDownWithDrain(t *testing.T) {
+	q := NewDelayingQueue()
+
+	q.AddAfter("foo", time.Hour)
+	q.Add("bar")
+	bar, _ := q.Get()
+
+	drained := make(chan struct{})
+	go func() {
+		q.ShutDownWithDrain()
+		close(drained)
+	}()
+
+	q.Done(bar)
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatalf("ShutDownWithDrain should not wait for delayed items")
+	}
+}
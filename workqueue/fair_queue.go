@@ -0,0 +1,91 @@
+package workqueue
+
+// fairQueue is a Queue which groups items in sub-queues by key and serves
+// the sub-queues round-robin, so that a single key flooding the queue can't
+// starve the others.
+type fairQueue[T comparable] struct {
+	keyFunc    func(item T) string
+	weightFunc func(key string) int
+
+	// queues holds the non-empty sub-queue of every key
+	queues map[string]*queue[T]
+	// active is the ring of keys having a non-empty sub-queue, in the order
+	// in which they are served
+	active []string
+	// next is the index in active of the key being served
+	next int
+	// served is how many items of the key being served have been popped
+	// in a row
+	served int
+
+	len int
+}
+
+// NewFairQueue returns a Queue, to be used in a TypedQueueConfig, which
+// groups items by the key returned by keyFunc (e.g. their namespace) and
+// pops one item of each key in turn. Items of the same key are popped in the
+// order in which they have been added.
+func NewFairQueue[T comparable](keyFunc func(item T) string) Queue[T] {
+	return NewWeightedFairQueue(keyFunc, nil)
+}
+
+// NewWeightedFairQueue is like NewFairQueue, but pops up to weightFunc(key)
+// items of a key in a row before moving on to the next key. A nil weightFunc
+// or a weight lower than 1 stands for 1.
+func NewWeightedFairQueue[T comparable](keyFunc func(item T) string, weightFunc func(key string) int) Queue[T] {
+	return &fairQueue[T]{
+		keyFunc:    keyFunc,
+		weightFunc: weightFunc,
+		queues:     map[string]*queue[T]{},
+	}
+}
+
+func (q *fairQueue[T]) Touch(item T) {}
+
+func (q *fairQueue[T]) Push(item T) {
+	key := q.keyFunc(item)
+	sub, ok := q.queues[key]
+	if !ok {
+		sub = new(queue[T])
+		q.queues[key] = sub
+		q.active = append(q.active, key)
+	}
+	sub.Push(item)
+	q.len++
+}
+
+func (q *fairQueue[T]) Len() int {
+	return q.len
+}
+
+func (q *fairQueue[T]) Pop() T {
+	key := q.active[q.next]
+	sub := q.queues[key]
+	item := sub.Pop()
+	q.len--
+	q.served++
+
+	if sub.Len() == 0 {
+		delete(q.queues, key)
+		q.active = append(q.active[:q.next], q.active[q.next+1:]...)
+		q.served = 0
+	} else if q.served >= q.weight(key) {
+		q.next++
+		q.served = 0
+	}
+	if q.next >= len(q.active) {
+		q.next = 0
+	}
+
+	return item
+}
+
+func (q *fairQueue[T]) weight(key string) int {
+	if q.weightFunc == nil {
+		return 1
+	}
+	if w := q.weightFunc(key); w > 1 {
+		return w
+	}
+	return 1
+}
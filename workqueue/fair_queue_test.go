@@ -0,0 +1,91 @@
+package workqueue
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// namespace returns the namespace of a "namespace/name" key.
+func namespace(item string) string {
+	return strings.SplitN(item, "/", 2)[0]
+}
+
+func TestFairQueue(t *testing.T) {
+	q := NewTypedWithConfig(TypedQueueConfig[string]{
+		Queue: NewFairQueue(namespace),
+	})
+	defer q.ShutDown()
+
+	for _, item := range []string{"noisy/1", "noisy/2", "noisy/3", "noisy/4", "a/1", "b/1", "a/2"} {
+		q.Add(item)
+	}
+	// dedup is global
+	q.Add("noisy/1")
+	q.Add("a/2")
+	if e, a := 7, q.Len(); e != a {
+		t.Fatalf("Expected %v, got %v", e, a)
+	}
+
+	var got []string
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		got = append(got, item)
+		q.Done(item)
+	}
+
+	expected := []string{"noisy/1", "a/1", "b/1", "noisy/2", "a/2", "noisy/3", "noisy/4"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestFairQueueProcessing(t *testing.T) {
+	q := NewTypedWithConfig(TypedQueueConfig[string]{
+		Queue: NewFairQueue(namespace),
+	})
+	defer q.ShutDown()
+
+	q.Add("a/1")
+	item, _ := q.Get()
+
+	// a/1 is processing, it is only pushed back once done
+	q.Add("a/1")
+	q.Add("b/1")
+	if e, a := 1, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	q.Done(item)
+	if e, a := 2, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+
+	for _, expected := range []string{"b/1", "a/1"} {
+		item, _ := q.Get()
+		if item != expected {
+			t.Errorf("Expected %v, got %v", expected, item)
+		}
+		q.Done(item)
+	}
+}
+
+func TestWeightedFairQueue(t *testing.T) {
+	weights := map[string]int{"gold": 3, "bronze": 0}
+	q := NewWeightedFairQueue(namespace, func(key string) int {
+		return weights[key]
+	})
+
+	for _, item := range []string{"gold/1", "gold/2", "gold/3", "gold/4", "bronze/1", "bronze/2", "silver/1"} {
+		q.Push(item)
+	}
+
+	var got []string
+	for q.Len() > 0 {
+		got = append(got, q.Pop())
+	}
+
+	expected := []string{"gold/1", "gold/2", "gold/3", "bronze/1", "silver/1", "gold/4", "bronze/2"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,161 @@
+package workqueue
+
+import (
+	"sync"
+)
+
+// InMemoryMetric implements every metric interface of this package and simply
+// remembers what has been reported to it.
+type InMemoryMetric struct {
+	lock         sync.Mutex
+	value        float64
+	observations []float64
+}
+
+func (m *InMemoryMetric) Inc() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.value++
+}
+
+func (m *InMemoryMetric) Dec() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.value--
+}
+
+func (m *InMemoryMetric) Set(v float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.value = v
+}
+
+func (m *InMemoryMetric) Observe(v float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.observations = append(m.observations, v)
+}
+
+// Value returns the current value of a gauge or counter.
+func (m *InMemoryMetric) Value() float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.value
+}
+
+// Observations returns a copy of every value observed by a histogram.
+func (m *InMemoryMetric) Observations() []float64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]float64(nil), m.observations...)
+}
+
+const (
+	depthMetric                          = "depth"
+	addsMetric                           = "adds"
+	latencyMetric                        = "latency"
+	workDurationMetric                   = "work_duration"
+	unfinishedWorkSecondsMetric          = "unfinished_work_seconds"
+	longestRunningProcessorSecondsMetric = "longest_running_processor_seconds"
+	retriesMetric                        = "retries"
+)
+
+// InMemoryMetricsProvider is a MetricsProvider that keeps the metrics of every
+// named queue in memory, which is mostly useful in tests.
+type InMemoryMetricsProvider struct {
+	lock    sync.Mutex
+	metrics map[string]map[string]*InMemoryMetric
+}
+
+var _ MetricsProvider = &InMemoryMetricsProvider{}
+
+func NewInMemoryMetricsProvider() *InMemoryMetricsProvider {
+	return &InMemoryMetricsProvider{
+		metrics: map[string]map[string]*InMemoryMetric{},
+	}
+}
+
+// metric returns the named metric of the named queue, creating it if needed.
+func (p *InMemoryMetricsProvider) metric(queue, metric string) *InMemoryMetric {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	metrics, ok := p.metrics[queue]
+	if !ok {
+		metrics = map[string]*InMemoryMetric{}
+		p.metrics[queue] = metrics
+	}
+	m, ok := metrics[metric]
+	if !ok {
+		m = &InMemoryMetric{}
+		metrics[metric] = m
+	}
+	return m
+}
+
+func (p *InMemoryMetricsProvider) NewDepthMetric(name string) GaugeMetric {
+	return p.Depth(name)
+}
+
+func (p *InMemoryMetricsProvider) NewAddsMetric(name string) CounterMetric {
+	return p.Adds(name)
+}
+
+func (p *InMemoryMetricsProvider) NewLatencyMetric(name string) HistogramMetric {
+	return p.Latency(name)
+}
+
+func (p *InMemoryMetricsProvider) NewWorkDurationMetric(name string) HistogramMetric {
+	return p.WorkDuration(name)
+}
+
+func (p *InMemoryMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) SettableGaugeMetric {
+	return p.UnfinishedWorkSeconds(name)
+}
+
+func (p *InMemoryMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) SettableGaugeMetric {
+	return p.LongestRunningProcessorSeconds(name)
+}
+
+func (p *InMemoryMetricsProvider) NewRetriesMetric(name string) CounterMetric {
+	return p.Retries(name)
+}
+
+// Depth returns the depth gauge of the named queue.
+func (p *InMemoryMetricsProvider) Depth(name string) *InMemoryMetric {
+	return p.metric(name, depthMetric)
+}
+
+// Adds returns the adds counter of the named queue.
+func (p *InMemoryMetricsProvider) Adds(name string) *InMemoryMetric {
+	return p.metric(name, addsMetric)
+}
+
+// Latency returns the histogram of seconds items of the named queue waited
+// between Add and Get.
+func (p *InMemoryMetricsProvider) Latency(name string) *InMemoryMetric {
+	return p.metric(name, latencyMetric)
+}
+
+// WorkDuration returns the histogram of seconds items of the named queue were
+// processed between Get and Done.
+func (p *InMemoryMetricsProvider) WorkDuration(name string) *InMemoryMetric {
+	return p.metric(name, workDurationMetric)
+}
+
+// UnfinishedWorkSeconds returns the gauge of seconds spent by all in-flight
+// items of the named queue.
+func (p *InMemoryMetricsProvider) UnfinishedWorkSeconds(name string) *InMemoryMetric {
+	return p.metric(name, unfinishedWorkSecondsMetric)
+}
+
+// LongestRunningProcessorSeconds returns the gauge of seconds spent by the
+// oldest in-flight item of the named queue.
+func (p *InMemoryMetricsProvider) LongestRunningProcessorSeconds(name string) *InMemoryMetric {
+	return p.metric(name, longestRunningProcessorSecondsMetric)
+}
+
+// Retries returns the retries counter of the named queue.
+func (p *InMemoryMetricsProvider) Retries(name string) *InMemoryMetric {
+	return p.metric(name, retriesMetric)
+}
@@ -0,0 +1,174 @@
+package workqueue
+
+import (
+	"sort"
+	"time"
+)
+
+// ItemState tells where an item is in a work queue.
+type ItemState string
+
+const (
+	// ItemPending items are waiting in the queue.
+	ItemPending ItemState = "Pending"
+	// ItemProcessing items have been handed out by Get and are not Done yet.
+	ItemProcessing ItemState = "Processing"
+	// ItemProcessingDirty items are processing and have been added again,
+	// they are queued again once Done.
+	ItemProcessingDirty ItemState = "ProcessingDirty"
+)
+
+// ItemStatus is the status of an item known to a work queue.
+type ItemStatus[T comparable] struct {
+	Item  T
+	State ItemState
+	// EnqueueTime is when the item was last added.
+	EnqueueTime time.Time
+	// ProcessingStartTime is when the item was handed out by Get, zero if
+	// the item is not processing.
+	ProcessingStartTime time.Time
+	// Requeues is how many times the item has been queued again because it
+	// was added while processing.
+	Requeues int
+}
+
+// ItemEventType is the type of an ItemEvent.
+type ItemEventType string
+
+const (
+	// ItemAdded is sent when an item is added to the queue.
+	ItemAdded ItemEventType = "Added"
+	// ItemDeduped is sent when an item is added while it is already waiting
+	// to be processed.
+	ItemDeduped ItemEventType = "Deduped"
+	// ItemStarted is sent when an item is handed out by Get.
+	ItemStarted ItemEventType = "Started"
+	// ItemDone is sent when an item is Done and leaves the queue.
+	ItemDone ItemEventType = "Done"
+	// ItemRequeued is sent when an item is Done and queued again because it
+	// was added while processing.
+	ItemRequeued ItemEventType = "Requeued"
+)
+
+// ItemEvent is something which happened to an item of a work queue.
+type ItemEvent[T comparable] struct {
+	Type ItemEventType
+	Item T
+	Time time.Time
+}
+
+// itemInfo is what the tracker knows about an item.
+type itemInfo struct {
+	enqueueTime         time.Time
+	processingStartTime time.Time
+	requeues            int
+}
+
+// itemTracker follows every item known to a work queue. Its methods are
+// called with the lock of the work queue held.
+type itemTracker[T comparable] struct {
+	items   map[T]*itemInfo
+	handler func(event ItemEvent[T])
+}
+
+func newItemTracker[T comparable]() *itemTracker[T] {
+	return &itemTracker[T]{
+		items: map[T]*itemInfo{},
+	}
+}
+
+func (t *itemTracker[T]) add(item T) {
+	now := time.Now()
+	info, ok := t.items[item]
+	if !ok {
+		info = &itemInfo{}
+		t.items[item] = info
+	}
+	info.enqueueTime = now
+	t.notify(ItemAdded, item, now)
+}
+
+func (t *itemTracker[T]) dedup(item T) {
+	t.notify(ItemDeduped, item, time.Now())
+}
+
+func (t *itemTracker[T]) get(item T) {
+	now := time.Now()
+	if info, ok := t.items[item]; ok {
+		info.processingStartTime = now
+	}
+	t.notify(ItemStarted, item, now)
+}
+
+func (t *itemTracker[T]) done(item T, requeued bool) {
+	info, ok := t.items[item]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if requeued {
+		info.processingStartTime = time.Time{}
+		info.requeues++
+		t.notify(ItemRequeued, item, now)
+		return
+	}
+
+	delete(t.items, item)
+	t.notify(ItemDone, item, now)
+}
+
+func (t *itemTracker[T]) notify(eventType ItemEventType, item T, now time.Time) {
+	if t.handler != nil {
+		t.handler(ItemEvent[T]{Type: eventType, Item: item, Time: now})
+	}
+}
+
+// status returns the status of item. t.cond.L must be held.
+func (t *TypedType[T]) status(item T) (ItemStatus[T], bool) {
+	info, ok := t.tracker.items[item]
+	if !ok {
+		return ItemStatus[T]{}, false
+	}
+
+	status := ItemStatus[T]{
+		Item:                item,
+		State:               ItemPending,
+		EnqueueTime:         info.enqueueTime,
+		ProcessingStartTime: info.processingStartTime,
+		Requeues:            info.requeues,
+	}
+	if t.processing.has(item) {
+		status.State = ItemProcessing
+		if t.dirty.has(item) {
+			status.State = ItemProcessingDirty
+		}
+	}
+	return status, true
+}
+
+// Status returns the status of item, or false if item is not known to the
+// queue.
+func (t *TypedType[T]) Status(item T) (ItemStatus[T], bool) {
+	t.cond.L.Lock()
+	defer t.cond.L.Unlock()
+
+	return t.status(item)
+}
+
+// Snapshot returns the status of every item known to the queue, ordered by
+// EnqueueTime.
+func (t *TypedType[T]) Snapshot() []ItemStatus[T] {
+	t.cond.L.Lock()
+	defer t.cond.L.Unlock()
+
+	snapshot := make([]ItemStatus[T], 0, len(t.tracker.items))
+	for item := range t.tracker.items {
+		status, _ := t.status(item)
+		snapshot = append(snapshot, status)
+	}
+	sort.SliceStable(snapshot, func(i, j int) bool {
+		return snapshot[i].EnqueueTime.Before(snapshot[j].EnqueueTime)
+	})
+	return snapshot
+}
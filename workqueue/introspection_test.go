@@ -0,0 +1,81 @@
+package workqueue
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	q := NewTyped[string]()
+	defer q.ShutDown()
+
+	q.Add("foo")
+	q.Add("bar")
+	q.Add("baz")
+
+	foo, _ := q.Get()
+	bar, _ := q.Get()
+	q.Add(bar)
+
+	snapshot := q.Snapshot()
+	states := map[string]ItemState{}
+	for _, status := range snapshot {
+		states[status.Item] = status.State
+	}
+	expected := map[string]ItemState{
+		"foo": ItemProcessing,
+		"bar": ItemProcessingDirty,
+		"baz": ItemPending,
+	}
+	if !reflect.DeepEqual(expected, states) {
+		t.Errorf("Expected %v, got %v", expected, states)
+	}
+
+	status, ok := q.Status(foo)
+	if !ok {
+		t.Fatalf("Expected %v to be known", foo)
+	}
+	if status.EnqueueTime.IsZero() || status.ProcessingStartTime.Before(status.EnqueueTime) {
+		t.Errorf("Unexpected times %v/%v", status.EnqueueTime, status.ProcessingStartTime)
+	}
+
+	q.Done(bar)
+	status, _ = q.Status(bar)
+	if status.State != ItemPending || status.Requeues != 1 || !status.ProcessingStartTime.IsZero() {
+		t.Errorf("Unexpected status of a requeued item: %+v", status)
+	}
+
+	q.Done(foo)
+	if _, ok := q.Status(foo); ok {
+		t.Errorf("Expected %v to be forgotten once done", foo)
+	}
+	if e, a := 2, len(q.Snapshot()); e != a {
+		t.Errorf("Expected %v items, got %v", e, a)
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	var events []ItemEventType
+	q := NewTypedWithConfig(TypedQueueConfig[string]{
+		EventHandler: func(event ItemEvent[string]) {
+			if event.Item != "foo" {
+				t.Errorf("Unexpected item %v", event.Item)
+			}
+			events = append(events, event.Type)
+		},
+	})
+	defer q.ShutDown()
+
+	q.Add("foo")
+	q.Add("foo")
+	item, _ := q.Get()
+	q.Add("foo")
+	q.Done(item)
+	item, _ = q.Get()
+	q.Done(item)
+
+	expected := []ItemEventType{ItemAdded, ItemDeduped, ItemStarted, ItemAdded, ItemRequeued, ItemStarted, ItemDone}
+	if !reflect.DeepEqual(expected, events) {
+		t.Errorf("Expected %v, got %v", expected, events)
+	}
+}
@@ -0,0 +1,356 @@
+package workqueue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// JournalOp is an operation of a work queue recorded in a Journal.
+type JournalOp string
+
+const (
+	JournalAdd  JournalOp = "add"
+	JournalGet  JournalOp = "get"
+	JournalDone JournalOp = "done"
+)
+
+// JournalEntry records an operation on an item, encoded to JSON.
+type JournalEntry struct {
+	Op   JournalOp       `json:"op"`
+	Item json.RawMessage `json:"item"`
+}
+
+// Journal is the storage of a write-ahead journal of a work queue.
+type Journal interface {
+	// Append records entry after the ones already recorded.
+	Append(entry JournalEntry) error
+	// Load returns every entry recorded so far, in order.
+	Load() ([]JournalEntry, error)
+	// Reset replaces every entry recorded so far by entries.
+	Reset(entries []JournalEntry) error
+}
+
+// queueJournal records the operations of a work queue. Its methods are
+// called with the lock of the work queue held.
+type queueJournal[T comparable] interface {
+	add(item T)
+	get(item T)
+	done(item T)
+}
+
+type noJournal[T comparable] struct{}
+
+func (noJournal[T]) add(item T)  {}
+func (noJournal[T]) get(item T)  {}
+func (noJournal[T]) done(item T) {}
+
+// journalCompactionMinEntries is the number of entries below which a journal
+// is never compacted while the queue runs.
+const journalCompactionMinEntries = 1024
+
+// journalCompactionRatio is how many entries per live item a journal may hold
+// before it is compacted while the queue runs.
+const journalCompactionRatio = 4
+
+type defaultQueueJournal[T comparable] struct {
+	journal     Journal
+	handleError func(err error)
+
+	// entries is the number of entries journal holds
+	entries int
+	// minCompactionEntries is the number of entries below which journal is
+	// never compacted
+	minCompactionEntries int
+	// live returns the number of items which are queued or processing
+	live func() int
+}
+
+func (j *defaultQueueJournal[T]) add(item T) {
+	j.record(JournalAdd, item)
+}
+
+func (j *defaultQueueJournal[T]) get(item T) {
+	j.record(JournalGet, item)
+}
+
+func (j *defaultQueueJournal[T]) done(item T) {
+	j.record(JournalDone, item)
+}
+
+func (j *defaultQueueJournal[T]) record(op JournalOp, item T) {
+	data, err := json.Marshal(item)
+	if err == nil {
+		err = j.journal.Append(JournalEntry{Op: op, Item: data})
+	}
+	if err != nil {
+		j.error(fmt.Errorf("failed to record %s of %v: %v", op, item, err))
+		return
+	}
+
+	j.entries++
+	if j.entries >= j.minCompactionEntries && j.entries >= journalCompactionRatio*j.live() {
+		j.compact()
+	}
+}
+
+// compact replaces the entries of journal by the fewest entries leading to
+// the same queue. Processing items stay processing, so that their Done can
+// still be recorded.
+func (j *defaultQueueJournal[T]) compact() {
+	entries, err := j.journal.Load()
+	if err == nil {
+		entries = replayJournal(entries).compacted()
+		err = j.journal.Reset(entries)
+	}
+	if err != nil {
+		j.error(fmt.Errorf("failed to compact journal: %v", err))
+		return
+	}
+	j.entries = len(entries)
+}
+
+func (j *defaultQueueJournal[T]) error(err error) {
+	if j.handleError != nil {
+		j.handleError(err)
+	}
+}
+
+// NewTypedWithJournal constructs a work queue which records every Add, Get
+// and Done in journal. The queue is first rebuilt from the entries journal
+// already holds: the items which were waiting are queued again, followed by
+// the items which were still processing, and journal is compacted to them.
+// While the queue runs, journal is compacted again whenever it holds several
+// entries per queued or processing item.
+//
+// Entries are appended, and journal compacted, with the lock of the queue
+// held: every Add, Get and Done waits for the write to journal, which a
+// FileJournal doesn't sync to disk.
+//
+// Items are encoded to JSON, T must survive a round trip through
+// encoding/json. Recording errors don't stop the queue, they are passed to
+// handleError if it is not nil.
+func NewTypedWithJournal[T comparable](config TypedQueueConfig[T], journal Journal, handleError func(err error)) (*TypedType[T], error) {
+	entries, err := journal.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load journal: %v", err)
+	}
+
+	pending := replayJournal(entries).pending()
+	items := make([]T, 0, len(pending))
+	compacted := make([]JournalEntry, 0, len(pending))
+	for _, data := range pending {
+		var item T
+		if err := json.Unmarshal(data, &item); err != nil {
+			return nil, fmt.Errorf("failed to decode journaled item %s: %v", data, err)
+		}
+		items = append(items, item)
+		compacted = append(compacted, JournalEntry{Op: JournalAdd, Item: data})
+	}
+	if err := journal.Reset(compacted); err != nil {
+		return nil, fmt.Errorf("failed to compact journal: %v", err)
+	}
+
+	t := NewTypedWithConfig(config)
+	for _, item := range items {
+		t.Add(item)
+	}
+	t.journal = &defaultQueueJournal[T]{
+		journal:              journal,
+		handleError:          handleError,
+		entries:              len(compacted),
+		minCompactionEntries: journalCompactionMinEntries,
+		live: func() int {
+			// a dirty item is either queued or processing, count it once
+			return t.queue.Len() + len(t.processing)
+		},
+	}
+	return t, nil
+}
+
+// journalState is the state of a queue rebuilt from the entries of its
+// journal, items are kept encoded.
+type journalState struct {
+	// queue holds the items waiting to be processed, in order
+	queue []string
+	// processing holds the items being processed, in the order they were got
+	processing []string
+	// dirty holds the items which have to be processed
+	dirty set[string]
+}
+
+// replayJournal rebuilds the state of a queue from entries.
+func replayJournal(entries []JournalEntry) *journalState {
+	s := &journalState{dirty: set[string]{}}
+	processing := set[string]{}
+
+	remove := func(items []string, item string) []string {
+		for i := range items {
+			if items[i] == item {
+				return append(items[:i], items[i+1:]...)
+			}
+		}
+		return items
+	}
+
+	for _, entry := range entries {
+		item := string(entry.Item)
+		switch entry.Op {
+		case JournalAdd:
+			if s.dirty.has(item) {
+				continue
+			}
+			s.dirty.insert(item)
+			if !processing.has(item) {
+				s.queue = append(s.queue, item)
+			}
+		case JournalGet:
+			s.queue = remove(s.queue, item)
+			s.dirty.delete(item)
+			processing.insert(item)
+			s.processing = append(s.processing, item)
+		case JournalDone:
+			processing.delete(item)
+			s.processing = remove(s.processing, item)
+			if s.dirty.has(item) {
+				s.queue = append(s.queue, item)
+			}
+		}
+	}
+	return s
+}
+
+// pending returns the items which still have to be processed after a
+// restart: the ones waiting in the queue followed by the ones which were
+// processing.
+func (s *journalState) pending() []json.RawMessage {
+	// items added again while processing are not in queue yet either
+	pending := make([]json.RawMessage, 0, len(s.queue)+len(s.processing))
+	for _, item := range s.queue {
+		pending = append(pending, json.RawMessage(item))
+	}
+	for _, item := range s.processing {
+		pending = append(pending, json.RawMessage(item))
+	}
+	return pending
+}
+
+// compacted returns the fewest entries which replay to s.
+func (s *journalState) compacted() []JournalEntry {
+	entries := make([]JournalEntry, 0, len(s.queue)+2*len(s.processing))
+	for _, item := range s.queue {
+		entries = append(entries, JournalEntry{Op: JournalAdd, Item: json.RawMessage(item)})
+	}
+	for _, item := range s.processing {
+		entries = append(entries,
+			JournalEntry{Op: JournalAdd, Item: json.RawMessage(item)},
+			JournalEntry{Op: JournalGet, Item: json.RawMessage(item)},
+		)
+		if s.dirty.has(item) {
+			entries = append(entries, JournalEntry{Op: JournalAdd, Item: json.RawMessage(item)})
+		}
+	}
+	return entries
+}
+
+// FileJournal is a Journal stored in a local file, one JSON encoded entry
+// per line.
+type FileJournal struct {
+	lock sync.Mutex
+	path string
+	file *os.File
+}
+
+var _ Journal = &FileJournal{}
+
+// NewFileJournal opens the journal stored at path, creating it if needed.
+func NewFileJournal(path string) (*FileJournal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileJournal{
+		path: path,
+		file: file,
+	}, nil
+}
+
+func (j *FileJournal) Append(entry JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	_, err = j.file.Write(append(data, '\n'))
+	return err
+}
+
+// Load returns the entries of the journal. A truncated last entry, left by
+// a crash in the middle of Append, is ignored.
+func (j *FileJournal) Load() ([]JournalEntry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			if !bytes.HasSuffix(data, []byte{'\n'}) && bytes.HasSuffix(data, scanner.Bytes()) {
+				break
+			}
+			return nil, fmt.Errorf("corrupted journal entry %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Reset atomically replaces the journal file by one holding entries.
+func (j *FileJournal) Reset(entries []JournalEntry) error {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	j.file.Close()
+	j.file = file
+	return nil
+}
+
+func (j *FileJournal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.file.Close()
+}
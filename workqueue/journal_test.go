@@ -0,0 +1,189 @@
+package workqueue
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// drain returns every queued item, marking them as done.
+func drain[T comparable](q *TypedType[T]) []T {
+	var items []T
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		items = append(items, item)
+		q.Done(item)
+	}
+	return items
+}
+
+func TestJournalRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	journal, err := NewFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewTypedWithJournal(TypedQueueConfig[string]{}, journal, func(err error) {
+		t.Errorf("Unexpected error: %v", err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range []string{"a", "b", "c", "d"} {
+		q.Add(item)
+	}
+	a, _ := q.Get()
+	b, _ := q.Get()
+	q.Done(b)
+	c, _ := q.Get()
+	// c is added again while processing
+	q.Add(c)
+
+	// crash
+	journal.Close()
+
+	journal, err = NewFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	q, err = NewTypedWithJournal(TypedQueueConfig[string]{}, journal, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// waiting items first, then the ones which were processing
+	expected := []string{"d", a, c}
+	if got := drain(q); !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	journal, err := NewFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	q, err := NewTypedWithJournal(TypedQueueConfig[int]{}, journal, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		q.Add(i)
+	}
+	drain(q)
+	q.Add(42)
+
+	q, err = NewTypedWithJournal(TypedQueueConfig[int]{}, journal, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := journal.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := []JournalEntry{{Op: JournalAdd, Item: []byte("42")}}, entries; !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+
+	// the compacted journal keeps recording
+	q.Add(7)
+	entries, err = journal.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := 2, len(entries); e != a {
+		t.Errorf("Expected %v entries, got %v", e, a)
+	}
+}
+
+func TestJournalRuntimeCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	journal, err := NewFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewTypedWithJournal(TypedQueueConfig[int]{}, journal, func(err error) {
+		t.Errorf("Unexpected error: %v", err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.journal.(*defaultQueueJournal[int]).minCompactionEntries = 16
+
+	// 1 stays processing, 2 is added again while processing
+	q.Add(1)
+	q.Add(2)
+	one, _ := q.Get()
+	two, _ := q.Get()
+	q.Add(two)
+	for i := 10; i < 100; i++ {
+		q.Add(i)
+		item, _ := q.Get()
+		q.Done(item)
+	}
+	q.Add(3)
+
+	entries, err := journal.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) >= 16 {
+		t.Errorf("Expected the journal to be compacted, got %v entries", len(entries))
+	}
+
+	// the Done of processing items still replays after compaction
+	q.Done(one)
+	q.Done(two)
+	journal.Close()
+
+	journal, err = NewFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	q, err = NewTypedWithJournal(TypedQueueConfig[int]{}, journal, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, a := []int{3, 2}, drain(q); !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+}
+
+func TestFileJournalTruncatedEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	data := `{"op":"add","item":"a"}` + "\n" + `{"op":"add","it`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	journal, err := NewFileJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	entries, err := journal.Load()
+	if err != nil {
+		t.Fatalf("Expected the truncated entry to be ignored, got %v", err)
+	}
+	if e, a := 1, len(entries); e != a {
+		t.Errorf("Expected %v entries, got %v", e, a)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"op":`+"\n"+data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journal.Load(); err == nil {
+		t.Errorf("Expected a corrupted entry to fail loading")
+	}
+}
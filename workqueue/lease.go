@@ -0,0 +1,144 @@
+package workqueue
+
+import (
+	"time"
+)
+
+// Lease is the right of a worker to process an item, see
+// TypedQueueConfig.LeaseDuration.
+type Lease[T comparable] struct {
+	Item T
+
+	// id tells apart the successive leases of an item, 0 if leases are not
+	// enabled
+	id uint64
+}
+
+// itemLease is the lease of a processing item.
+type itemLease struct {
+	id    uint64
+	timer *time.Timer
+}
+
+// grantLease starts the lease of an item which has just been handed out and
+// returns its id, 0 if leases are not enabled. t.cond.L must be held.
+func (t *TypedType[T]) grantLease(item T) uint64 {
+	if t.leaseDuration <= 0 {
+		return 0
+	}
+
+	t.leaseID++
+	t.startLease(item, t.leaseID)
+	return t.leaseID
+}
+
+// startLease starts a timer expiring lease id of item in LeaseDuration.
+// Every timer gets its own itemLease, which tells apart a timer which fired
+// before it was replaced. t.cond.L must be held.
+func (t *TypedType[T]) startLease(item T, id uint64) {
+	l := &itemLease{id: id}
+	l.timer = time.AfterFunc(t.leaseDuration, func() {
+		t.expireLease(item, l)
+	})
+	t.leases[item] = l
+}
+
+// revokeLease ends the lease of item. t.cond.L must be held.
+func (t *TypedType[T]) revokeLease(item T) {
+	if lease, ok := t.leases[item]; ok {
+		lease.timer.Stop()
+		delete(t.leases, item)
+	}
+}
+
+// leased returns whether item has an outstanding lease. t.cond.L must be
+// held.
+func (t *TypedType[T]) leased(item T) bool {
+	_, ok := t.leases[item]
+	return ok
+}
+
+// expireLease queues item again if l is still its current lease, it may have
+// been replaced while the timer of l fired.
+func (t *TypedType[T]) expireLease(item T, l *itemLease) {
+	t.cond.L.Lock()
+	if t.leases[item] != l {
+		t.cond.L.Unlock()
+		return
+	}
+
+	// the item is queued again even if the queue is shutting down, it was
+	// accepted before
+	if !t.dirty.has(item) {
+		t.metrics.add(item)
+		t.journal.add(item)
+		t.tracker.add(item)
+		t.dirty.insert(item)
+	}
+	t.doneLocked(item)
+	t.cond.L.Unlock()
+
+	if t.onLeaseExpired != nil {
+		t.onLeaseExpired(item)
+	}
+}
+
+// GetWithLease is like Get, but also returns the lease of the item, which
+// lets DoneWithLease and ExtendLease tell apart a stale worker from the one
+// which got the item again after the lease expired.
+func (t *TypedType[T]) GetWithLease() (Lease[T], bool) {
+	t.cond.L.Lock()
+	defer t.cond.L.Unlock()
+
+	for t.queue.Len() == 0 && !t.shuttingDown {
+		t.cond.Wait()
+	}
+
+	if t.queue.Len() == 0 {
+		return Lease[T]{}, true
+	}
+
+	item := t.getLocked()
+	return Lease[T]{Item: item, id: t.grantLease(item)}, false
+}
+
+// current returns whether lease is the current lease of its item. t.cond.L
+// must be held.
+func (t *TypedType[T]) current(lease Lease[T]) bool {
+	if t.leaseDuration <= 0 {
+		return t.processing.has(lease.Item)
+	}
+	l, ok := t.leases[lease.Item]
+	return ok && l.id == lease.id
+}
+
+// DoneWithLease marks the item of lease as done. It returns false, and does
+// nothing, if lease expired.
+func (t *TypedType[T]) DoneWithLease(lease Lease[T]) bool {
+	t.cond.L.Lock()
+	defer t.cond.L.Unlock()
+
+	if !t.current(lease) {
+		return false
+	}
+	t.doneLocked(lease.Item)
+	return true
+}
+
+// ExtendLease grants lease another LeaseDuration from now. It returns false
+// if lease expired.
+func (t *TypedType[T]) ExtendLease(lease Lease[T]) bool {
+	t.cond.L.Lock()
+	defer t.cond.L.Unlock()
+
+	if !t.current(lease) {
+		return false
+	}
+	if l, ok := t.leases[lease.Item]; ok {
+		// the timer of l may have fired already, with expireLease waiting
+		// for the lock: replace l, so that expireLease ignores it
+		l.timer.Stop()
+		t.startLease(lease.Item, l.id)
+	}
+	return true
+}
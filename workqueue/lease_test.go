@@ -0,0 +1,177 @@
+package workqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaseExpiration(t *testing.T) {
+	expired := make(chan string, 1)
+	q := NewTypedWithConfig(TypedQueueConfig[string]{
+		LeaseDuration: 20 * time.Millisecond,
+		OnLeaseExpired: func(item string) {
+			expired <- item
+		},
+	})
+	defer q.ShutDown()
+
+	q.Add("foo")
+	stale, _ := q.GetWithLease()
+
+	select {
+	case item := <-expired:
+		if item != "foo" {
+			t.Errorf("Expected foo, got %v", item)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the lease to expire")
+	}
+	if e, a := 1, q.Len(); e != a {
+		t.Fatalf("Expected the item to be queued again, got %v items", a)
+	}
+
+	// the stale worker can neither extend nor finish the item
+	if q.ExtendLease(stale) {
+		t.Errorf("Expected an expired lease not to be extended")
+	}
+	if q.DoneWithLease(stale) {
+		t.Errorf("Expected an expired lease not to be done")
+	}
+	q.Done("foo")
+	if e, a := 1, q.Len(); e != a {
+		t.Errorf("Expected the stale Done to be ignored, got %v items", a)
+	}
+
+	fresh, _ := q.GetWithLease()
+	if q.DoneWithLease(stale) {
+		t.Errorf("Expected a stale lease not to finish the new one")
+	}
+	// a plain Done from the stale worker can't finish the new one either
+	q.Done("foo")
+	if status, ok := q.Status("foo"); !ok || status.State != ItemProcessing {
+		t.Errorf("Expected foo to be processing, got %+v/%v", status, ok)
+	}
+	if !q.DoneWithLease(fresh) {
+		t.Errorf("Expected the current lease to be done")
+	}
+
+	select {
+	case item := <-expired:
+		t.Errorf("Unexpected expiration of %v", item)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if status, ok := q.Status("foo"); ok {
+		t.Errorf("Expected foo to be done, got %+v", status)
+	}
+}
+
+func TestExtendLease(t *testing.T) {
+	q := NewTypedWithConfig(TypedQueueConfig[string]{
+		LeaseDuration: 30 * time.Millisecond,
+	})
+	defer q.ShutDown()
+
+	q.Add("foo")
+	lease, _ := q.GetWithLease()
+	for i := 0; i < 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if !q.ExtendLease(lease) {
+			t.Fatalf("Expected the lease to be extended")
+		}
+	}
+	if e, a := 0, q.Len(); e != a {
+		t.Errorf("Expected an extended lease not to expire, got %v items", a)
+	}
+	if !q.DoneWithLease(lease) {
+		t.Errorf("Expected the lease to be done")
+	}
+}
+
+func TestExtendLeaseAfterTimerFired(t *testing.T) {
+	q := NewTypedWithConfig(TypedQueueConfig[string]{
+		LeaseDuration: time.Hour,
+	})
+	defer q.ShutDown()
+
+	q.Add("foo")
+	lease, _ := q.GetWithLease()
+
+	// the timer fires, and its expireLease waits for the lock while the
+	// lease is extended
+	q.cond.L.Lock()
+	fired := q.leases["foo"]
+	q.cond.L.Unlock()
+	if !q.ExtendLease(lease) {
+		t.Fatalf("Expected the lease to be extended")
+	}
+	q.expireLease("foo", fired)
+
+	if e, a := 0, q.Len(); e != a {
+		t.Errorf("Expected an extended lease not to expire, got %v items", a)
+	}
+	if !q.DoneWithLease(lease) {
+		t.Errorf("Expected the extended lease to be done")
+	}
+}
+
+func TestLeaseRequeuesDirtyItem(t *testing.T) {
+	q := NewTypedWithConfig(TypedQueueConfig[string]{
+		LeaseDuration: 10 * time.Millisecond,
+	})
+	defer q.ShutDown()
+
+	q.Add("foo")
+	q.GetWithLease()
+	q.Add("foo")
+
+	if !waitForLen(q, 1, time.Second) {
+		t.Fatalf("Expected the item to be queued again")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if e, a := 1, q.Len(); e != a {
+		t.Errorf("Expected the item to be queued once, got %v items", a)
+	}
+}
+
+func TestLeaseGetDone(t *testing.T) {
+	q := NewTypedWithConfig(TypedQueueConfig[string]{
+		LeaseDuration: 10 * time.Millisecond,
+	})
+	defer q.ShutDown()
+
+	q.Add("foo")
+	item, _ := q.Get()
+	time.Sleep(30 * time.Millisecond)
+	if e, a := 0, q.Len(); e != a {
+		t.Errorf("Expected an item got without a lease not to be queued again, got %v items", a)
+	}
+	q.Done(item)
+	if status, ok := q.Status("foo"); ok {
+		t.Errorf("Expected foo to be done, got %+v", status)
+	}
+
+	q.Add("bar")
+	items, _ := q.GetBatch(1, 0)
+	time.Sleep(30 * time.Millisecond)
+	q.DoneBatch(items)
+	if status, ok := q.Status("bar"); ok {
+		t.Errorf("Expected bar to be done, got %+v", status)
+	}
+}
+
+func TestLeaseDisabled(t *testing.T) {
+	q := NewTyped[string]()
+	defer q.ShutDown()
+
+	q.Add("foo")
+	lease, _ := q.GetWithLease()
+	if !q.ExtendLease(lease) {
+		t.Errorf("Expected a processing item to be extended without leases")
+	}
+	if !q.DoneWithLease(lease) {
+		t.Errorf("Expected a processing item to be done without leases")
+	}
+	if q.DoneWithLease(lease) {
+		t.Errorf("Expected a done item not to be done again")
+	}
+}
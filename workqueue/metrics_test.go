@@ -0,0 +1,97 @@
+package workqueue
+
+import (
+	"testing"
+	"time"
+
+	clock "github.com/YaoZengzeng/gok8s/fakeclock"
+)
+
+func TestMetrics(t *testing.T) {
+	mp := NewInMemoryMetricsProvider()
+	q := newQueue(DefaultQueue[string](), newQueueMetrics[string](mp, "test"), time.Millisecond)
+	defer q.ShutDown()
+
+	q.Add("foo")
+	if e, a := 1.0, mp.Adds("test").Value(); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if e, a := 1.0, mp.Depth("test").Value(); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+
+	// duplicates are not counted
+	q.Add("foo")
+	if e, a := 1.0, mp.Adds("test").Value(); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+
+	i, _ := q.Get()
+	if e, a := 0.0, mp.Depth("test").Value(); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if e, a := 1, len(mp.Latency("test").Observations()); e != a {
+		t.Errorf("expected %v latency observations, got %v", e, a)
+	}
+
+	// the item is processing, wait for the unfinished work gauges to pick it up
+	deadline := time.Now().Add(time.Second)
+	for mp.LongestRunningProcessorSeconds("test").Value() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if a := mp.LongestRunningProcessorSeconds("test").Value(); a <= 0 {
+		t.Errorf("expected a positive longest running processor, got %v", a)
+	}
+	if a := mp.UnfinishedWorkSeconds("test").Value(); a <= 0 {
+		t.Errorf("expected positive unfinished work, got %v", a)
+	}
+
+	// re-add while processing
+	q.Add(i)
+	if e, a := 2.0, mp.Adds("test").Value(); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if e, a := 1.0, mp.Depth("test").Value(); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+
+	q.Done(i)
+	if e, a := 1, len(mp.WorkDuration("test").Observations()); e != a {
+		t.Errorf("expected %v work duration observations, got %v", e, a)
+	}
+
+	i, _ = q.Get()
+	q.Done(i)
+	if e, a := 0.0, mp.Depth("test").Value(); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if e, a := 2, len(mp.Latency("test").Observations()); e != a {
+		t.Errorf("expected %v latency observations, got %v", e, a)
+	}
+	if e, a := 2, len(mp.WorkDuration("test").Observations()); e != a {
+		t.Errorf("expected %v work duration observations, got %v", e, a)
+	}
+}
+
+func TestNoMetricsForUnnamedQueue(t *testing.T) {
+	mp := NewInMemoryMetricsProvider()
+	if _, ok := newQueueMetrics[string](mp, "").(noMetrics[string]); !ok {
+		t.Errorf("expected an unnamed queue not to report metrics")
+	}
+	if _, ok := newQueueMetrics[string](noopMetricsProvider{}, "test").(noMetrics[string]); !ok {
+		t.Errorf("expected the noop provider not to report metrics")
+	}
+}
+
+func TestRetryMetrics(t *testing.T) {
+	mp := NewInMemoryMetricsProvider()
+	q := newDelayingQueue(clock.RealClock{}, New(), "")
+	q.metrics = newRetryMetrics(mp, "retry")
+	defer q.ShutDown()
+
+	q.AddAfter("foo", 0)
+	q.AddAfter("bar", time.Hour)
+	if e, a := 2.0, mp.Retries("retry").Value(); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
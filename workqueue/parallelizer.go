@@ -0,0 +1,146 @@
+package workqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type DoWorkPieceFunc func(piece int)
+
+// DoWorkPieceWithErrorFunc processes a piece and reports whether it failed.
+type DoWorkPieceWithErrorFunc func(piece int) error
+
+type options struct {
+	chunkSize int
+	allErrors bool
+}
+
+type Options func(*options)
+
+// WithChunkSize allows to set chunks of work items to the workers, rather than
+// processing one by one.
+// It is recommended to use this option if the number of pieces significantly
+// higher than the number of workers and the work done for each item is small.
+func WithChunkSize(c int) func(*options) {
+	return func(o *options) {
+		o.chunkSize = c
+	}
+}
+
+// WithAllErrors makes ParallelizeUntilWithError process every piece and
+// return all the errors, rather than stopping at the first one.
+func WithAllErrors() func(*options) {
+	return func(o *options) {
+		o.allErrors = true
+	}
+}
+
+// ParallelizeUntil is a framework that allows for parallelizing N
+// independent pieces of work until done or the context is canceled.
+func ParallelizeUntil(ctx context.Context, workers, pieces int, doWorkPiece DoWorkPieceFunc, opts ...Options) {
+	ParallelizeUntilWithError(ctx, workers, pieces, func(piece int) error {
+		doWorkPiece(piece)
+		return nil
+	}, opts...)
+}
+
+// ParallelizeUntilWithError is like ParallelizeUntil for pieces which may
+// fail. It stops handing out pieces once one failed and returns its error,
+// unless WithAllErrors is set, in which case every piece is processed and
+// the errors are joined. If pieces are left unprocessed because ctx is done,
+// ctx.Err() is returned, joined with the errors of the pieces in the latter
+// case.
+func ParallelizeUntilWithError(ctx context.Context, workers, pieces int, doWorkPiece DoWorkPieceWithErrorFunc, opts ...Options) error {
+	if pieces <= 0 {
+		return nil
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	chunkSize := o.chunkSize
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+
+	chunks := ceilDiv(pieces, chunkSize)
+	toProcess := make(chan int, chunks)
+	for i := 0; i < chunks; i++ {
+		toProcess <- i
+	}
+	close(toProcess)
+
+	var stop <-chan struct{}
+	if ctx != nil {
+		stop = ctx.Done()
+	}
+	// failed is closed once a piece failed, unless every error is collected
+	failed := make(chan struct{})
+	var failOnce sync.Once
+
+	var lock sync.Mutex
+	var errs []error
+	// canceled is set once a piece was skipped because ctx is done
+	canceled := false
+
+	if chunks < workers {
+		workers = chunks
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for chunk := range toProcess {
+				start := chunk * chunkSize
+				end := start + chunkSize
+				if end > pieces {
+					end = pieces
+				}
+				for p := start; p < end; p++ {
+					select {
+					case <-stop:
+						lock.Lock()
+						canceled = true
+						lock.Unlock()
+						return
+					case <-failed:
+						return
+					default:
+					}
+					if err := doWorkPiece(p); err != nil {
+						lock.Lock()
+						errs = append(errs, err)
+						lock.Unlock()
+						if !o.allErrors {
+							failOnce.Do(func() { close(failed) })
+						}
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) > 0 && !o.allErrors {
+		return errs[0]
+	}
+	if canceled {
+		errs = append(errs, ctx.Err())
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
@@ -0,0 +1,156 @@
+package workqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+type parallelizeTestCase struct {
+	pieces    int
+	workers   int
+	chunkSize int
+}
+
+func (c parallelizeTestCase) String() string {
+	return fmt.Sprintf("pieces:%d,workers:%d,chunkSize:%d", c.pieces, c.workers, c.chunkSize)
+}
+
+var parallelizeCases = []parallelizeTestCase{
+	{
+		pieces:    1000,
+		workers:   10,
+		chunkSize: 1,
+	},
+	{
+		pieces:    1000,
+		workers:   10,
+		chunkSize: 10,
+	},
+	{
+		pieces:    1000,
+		workers:   10,
+		chunkSize: 100,
+	},
+	{
+		pieces:    999,
+		workers:   10,
+		chunkSize: 13,
+	},
+}
+
+func TestParallelizeUntil(t *testing.T) {
+	for _, tc := range parallelizeCases {
+		t.Run(tc.String(), func(t *testing.T) {
+			seen := make([]int32, tc.pieces)
+			ctx := context.Background()
+			ParallelizeUntil(ctx, tc.workers, tc.pieces, func(p int) {
+				atomic.AddInt32(&seen[p], 1)
+			}, WithChunkSize(tc.chunkSize))
+
+			wantSeen := make([]int32, tc.pieces)
+			for i := 0; i < tc.pieces; i++ {
+				wantSeen[i] = 1
+			}
+			for i := range seen {
+				if seen[i] != wantSeen[i] {
+					t.Fatalf("piece %d processed %d times, expected %d", i, seen[i], wantSeen[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParallelizeUntilCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var processed int32
+	ParallelizeUntil(ctx, 1, 100, func(p int) {
+		if atomic.AddInt32(&processed, 1) == 10 {
+			cancel()
+		}
+	})
+	if e, a := int32(10), atomic.LoadInt32(&processed); e != a {
+		t.Errorf("Expected %v pieces to be processed, got %v", e, a)
+	}
+}
+
+func TestParallelizeUntilWithErrorCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var processed int32
+	err := ParallelizeUntilWithError(ctx, 4, 100, func(p int) error {
+		atomic.AddInt32(&processed, 1)
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if e, a := int32(0), atomic.LoadInt32(&processed); e != a {
+		t.Errorf("Expected %v pieces to be processed, got %v", e, a)
+	}
+
+	// every piece is processed before ctx is done
+	ctx, cancel = context.WithCancel(context.Background())
+	err = ParallelizeUntilWithError(ctx, 4, 10, func(p int) error { return nil })
+	cancel()
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestParallelizeUntilWithError(t *testing.T) {
+	errOdd := errors.New("odd")
+
+	var processed int32
+	err := ParallelizeUntilWithError(context.Background(), 1, 100, func(p int) error {
+		atomic.AddInt32(&processed, 1)
+		if p == 5 {
+			return errOdd
+		}
+		return nil
+	})
+	if err != errOdd {
+		t.Errorf("Expected %v, got %v", errOdd, err)
+	}
+	if e, a := int32(6), atomic.LoadInt32(&processed); e != a {
+		t.Errorf("Expected the first error to stop processing after %v pieces, got %v", e, a)
+	}
+
+	processed = 0
+	err = ParallelizeUntilWithError(context.Background(), 4, 100, func(p int) error {
+		atomic.AddInt32(&processed, 1)
+		if p%2 == 1 {
+			return fmt.Errorf("piece %d: %w", p, errOdd)
+		}
+		return nil
+	}, WithAllErrors(), WithChunkSize(7))
+	if !errors.Is(err, errOdd) {
+		t.Errorf("Expected %v, got %v", errOdd, err)
+	}
+	if e, a := int32(100), atomic.LoadInt32(&processed); e != a {
+		t.Errorf("Expected every piece to be processed, got %v", a)
+	}
+	if e, a := 50, len(err.(interface{ Unwrap() []error }).Unwrap()); e != a {
+		t.Errorf("Expected %v errors, got %v", e, a)
+	}
+
+	if err := ParallelizeUntilWithError(context.Background(), 4, 0, nil); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := ParallelizeUntilWithError(context.Background(), 4, -1, nil); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestParallelizeUntilNoWorkers(t *testing.T) {
+	var processed int32
+	ParallelizeUntil(context.Background(), 0, 10, func(p int) {
+		atomic.AddInt32(&processed, 1)
+	})
+	if e, a := int32(10), atomic.LoadInt32(&processed); e != a {
+		t.Errorf("Expected %v pieces to be processed, got %v", e, a)
+	}
+}
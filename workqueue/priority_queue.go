@@ -0,0 +1,176 @@
+package workqueue
+
+import (
+	"github.com/YaoZengzeng/gok8s/heap"
+)
+
+// PriorityInterface is the interface{} flavour of TypedPriorityInterface.
+type PriorityInterface = TypedPriorityInterface[interface{}]
+
+// TypedPriorityInterface is a TypedInterface which hands out the items with
+// the highest priority first. Items of the same priority are handed out in
+// the order in which they have been added.
+type TypedPriorityInterface[T comparable] interface {
+	TypedInterface[T]
+	// AddWithPriority adds item with the given priority. If item is already
+	// waiting to be processed, it keeps the highest of both priorities.
+	AddWithPriority(item T, priority int)
+}
+
+// PriorityType is the interface{} flavour of TypedPriorityType.
+type PriorityType = TypedPriorityType[interface{}]
+
+// TypedPriorityType is a work queue ordered by priority. It keeps the
+// dedup and processing set guarantees of TypedType.
+type TypedPriorityType[T comparable] struct {
+	*TypedType[T]
+
+	queue *priorityQueue[T]
+}
+
+func NewPriorityQueue() *PriorityType {
+	return NewTypedPriorityQueueWithConfig(QueueConfig{})
+}
+
+func NewTypedPriorityQueue[T comparable]() *TypedPriorityType[T] {
+	return NewTypedPriorityQueueWithConfig(TypedQueueConfig[T]{})
+}
+
+// NewTypedPriorityQueueWithConfig constructs a new priority work queue, the
+// Queue of config is replaced by a priority queue.
+func NewTypedPriorityQueueWithConfig[T comparable](config TypedQueueConfig[T]) *TypedPriorityType[T] {
+	queue := newPriorityQueue[T]()
+	config.Queue = queue
+	return &TypedPriorityType[T]{
+		TypedType: NewTypedWithConfig(config),
+		queue:     queue,
+	}
+}
+
+// Add adds item with the lowest priority, 0.
+func (q *TypedPriorityType[T]) Add(item T) {
+	q.AddWithPriority(item, 0)
+}
+
+func (q *TypedPriorityType[T]) AddWithPriority(item T, priority int) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if q.shuttingDown {
+		return
+	}
+
+	q.queue.prioritize(item, priority)
+	q.addLocked(item)
+}
+
+// priorityItem is an item waiting in a priorityQueue.
+type priorityItem[T comparable] struct {
+	item     T
+	priority int
+	// sequence orders the items of the same priority
+	sequence uint64
+	// index in the heap, -1 if the item is not in the heap yet
+	index int
+}
+
+// priorityQueue is a Queue which pops the item with the highest priority
+// first. The priority of an item is remembered from the moment it is
+// prioritized until it is popped, so that an item added while it is
+// processing is pushed with the right priority once it is done.
+type priorityQueue[T comparable] struct {
+	heap     []*priorityItem[T]
+	items    map[T]*priorityItem[T]
+	sequence uint64
+	// processing holds the priority of the popped items until they are
+	// done, an item pushed again without being added, e.g. because its
+	// lease expired, keeps it
+	processing map[T]int
+}
+
+func newPriorityQueue[T comparable]() *priorityQueue[T] {
+	return &priorityQueue[T]{
+		items:      map[T]*priorityItem[T]{},
+		processing: map[T]int{},
+	}
+}
+
+// prioritize raises the priority of item to priority.
+func (pq *priorityQueue[T]) prioritize(item T, priority int) {
+	existing, ok := pq.items[item]
+	if !ok {
+		pq.items[item] = &priorityItem[T]{item: item, priority: priority, index: -1}
+		return
+	}
+	if priority > existing.priority {
+		existing.priority = priority
+	}
+}
+
+func (pq *priorityQueue[T]) Touch(item T) {
+	if existing, ok := pq.items[item]; ok && existing.index >= 0 {
+		heap.Fix((*priorityHeap[T])(pq), existing.index)
+	}
+}
+
+func (pq *priorityQueue[T]) Push(item T) {
+	existing, ok := pq.items[item]
+	if !ok {
+		existing = &priorityItem[T]{item: item, priority: pq.processing[item]}
+		pq.items[item] = existing
+	}
+	delete(pq.processing, item)
+	existing.sequence = pq.sequence
+	pq.sequence++
+	heap.Push((*priorityHeap[T])(pq), existing)
+}
+
+func (pq *priorityQueue[T]) Len() int {
+	return len(pq.heap)
+}
+
+func (pq *priorityQueue[T]) Pop() T {
+	popped := heap.Pop((*priorityHeap[T])(pq)).(*priorityItem[T])
+	delete(pq.items, popped.item)
+	pq.processing[popped.item] = popped.priority
+	return popped.item
+}
+
+func (pq *priorityQueue[T]) Done(item T) {
+	delete(pq.processing, item)
+}
+
+// priorityHeap implements heap.Interface over the heap of a priorityQueue.
+type priorityHeap[T comparable] priorityQueue[T]
+
+func (h *priorityHeap[T]) Len() int {
+	return len(h.heap)
+}
+
+func (h *priorityHeap[T]) Less(i, j int) bool {
+	if h.heap[i].priority != h.heap[j].priority {
+		return h.heap[i].priority > h.heap[j].priority
+	}
+	return h.heap[i].sequence < h.heap[j].sequence
+}
+
+func (h *priorityHeap[T]) Swap(i, j int) {
+	h.heap[i], h.heap[j] = h.heap[j], h.heap[i]
+	h.heap[i].index = i
+	h.heap[j].index = j
+}
+
+func (h *priorityHeap[T]) Push(x interface{}) {
+	item := x.(*priorityItem[T])
+	item.index = len(h.heap)
+	h.heap = append(h.heap, item)
+}
+
+func (h *priorityHeap[T]) Pop() interface{} {
+	n := len(h.heap)
+	item := h.heap[n-1]
+	item.index = -1
+	h.heap[n-1] = nil
+	h.heap = h.heap[:n-1]
+	return item
+}
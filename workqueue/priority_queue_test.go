@@ -0,0 +1,107 @@
+package workqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriorityQueue(t *testing.T) {
+	q := NewPriorityQueue()
+	defer q.ShutDown()
+
+	q.Add("resync-1")
+	q.AddWithPriority("delete", 10)
+	q.Add("resync-2")
+	q.AddWithPriority("user", 5)
+	q.Add("resync-3")
+
+	// the highest priority seen for a pending item wins
+	q.AddWithPriority("resync-3", 7)
+	q.AddWithPriority("delete", 1)
+
+	if e, a := 5, q.Len(); e != a {
+		t.Fatalf("Expected %v, got %v", e, a)
+	}
+
+	for _, expected := range []string{"delete", "resync-3", "user", "resync-1", "resync-2"} {
+		item, _ := q.Get()
+		if item != expected {
+			t.Errorf("Expected %v, got %v", expected, item)
+		}
+		q.Done(item)
+	}
+}
+
+func TestPriorityQueueProcessing(t *testing.T) {
+	q := NewTypedPriorityQueue[string]()
+	defer q.ShutDown()
+
+	q.Add("foo")
+	foo, _ := q.Get()
+
+	// foo is processing, it is pushed with its priority once done
+	q.AddWithPriority("foo", 3)
+	q.AddWithPriority("bar", 2)
+	if e, a := 1, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	q.Done(foo)
+	if e, a := 2, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+
+	for _, expected := range []string{"foo", "bar"} {
+		item, _ := q.Get()
+		if item != expected {
+			t.Errorf("Expected %v, got %v", expected, item)
+		}
+		q.Done(item)
+	}
+
+	// the priority of a popped item is forgotten
+	q.Add("foo")
+	q.AddWithPriority("bar", 1)
+	if item, _ := q.Get(); item != "bar" {
+		t.Errorf("Expected %v, got %v", "bar", item)
+	}
+}
+
+func TestPriorityQueueShutDown(t *testing.T) {
+	q := NewTypedPriorityQueue[string]()
+	q.ShutDown()
+
+	q.AddWithPriority("foo", 1)
+	if e, a := 0, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	if e, a := 0, len(q.queue.items); e != a {
+		t.Errorf("Expected no priority to be remembered after shutdown, got %v", a)
+	}
+}
+
+func TestPriorityQueueLeaseExpiration(t *testing.T) {
+	q := NewTypedPriorityQueueWithConfig(TypedQueueConfig[string]{
+		LeaseDuration: 10 * time.Millisecond,
+	})
+	defer q.ShutDown()
+
+	q.AddWithPriority("urgent", 10)
+	q.GetWithLease()
+	q.Add("resync-1")
+	q.Add("resync-2")
+
+	// the expired item is queued again with its priority
+	if !waitForLen(q, 3, time.Second) {
+		t.Fatalf("Expected the lease to expire")
+	}
+	for _, expected := range []string{"urgent", "resync-1", "resync-2"} {
+		item, _ := q.Get()
+		if item != expected {
+			t.Errorf("Expected %v, got %v", expected, item)
+		}
+		q.Done(item)
+	}
+	if e, a := 0, len(q.queue.processing); e != a {
+		t.Errorf("Expected the priorities of done items to be forgotten, got %v", a)
+	}
+}
@@ -0,0 +1,38 @@
+package workqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitingQueue(t *testing.T) {
+	limiter := NewItemExponentialFailureRateLimiter(10*time.Millisecond, time.Second)
+	queue := NewRateLimitingQueue(limiter)
+	defer queue.ShutDown()
+
+	queue.AddRateLimited("one")
+	queue.AddRateLimited("two")
+	if queue.Len() != 0 {
+		t.Errorf("rate limited items should not be added immediately")
+	}
+	if !waitForLen(queue, 2, time.Second) {
+		t.Fatalf("expected two items, got %v", queue.Len())
+	}
+
+	queue.AddRateLimited("one")
+	if e, a := 2, queue.NumRequeues("one"); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if e, a := 1, queue.NumRequeues("two"); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+
+	queue.Forget("one")
+	if e, a := 0, queue.NumRequeues("one"); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	queue.Forget("two")
+	if e, a := 0, queue.NumRequeues("two"); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
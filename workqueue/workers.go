@@ -0,0 +1,114 @@
+package workqueue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ProcessFunc processes an item got from a queue.
+type ProcessFunc[T comparable] func(ctx context.Context, item T) error
+
+// RequeuePolicy decides what happens to an item once it has been processed.
+type RequeuePolicy[T comparable] interface {
+	// Retry is called when processing item failed with err.
+	Retry(item T, err error)
+	// Forget is called when item has been processed successfully.
+	Forget(item T)
+}
+
+// RunWorkers starts workers goroutines which Get items from q, process them
+// and mark them as Done, even if process panics. A panic is recovered and
+// reported to the policy as an error. If policy is nil, failed items are
+// dropped.
+//
+// q is shut down when ctx is done, and the workers stop processing items,
+// even if some are still queued. RunWorkers blocks until q has been shut
+// down and every worker has returned.
+func RunWorkers[T comparable](ctx context.Context, q TypedInterface[T], workers int, process ProcessFunc[T], policy RequeuePolicy[T]) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	stop := context.AfterFunc(ctx, q.ShutDown)
+	defer stop()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for processNextItem(ctx, q, process, policy) {
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		// the workers may have returned before the AfterFunc ran
+		q.ShutDown()
+	}
+}
+
+// processNextItem processes a single item of q, it returns false once q has
+// been shut down or ctx is done.
+func processNextItem[T comparable](ctx context.Context, q TypedInterface[T], process ProcessFunc[T], policy RequeuePolicy[T]) bool {
+	item, shutdown := q.Get()
+	if shutdown {
+		return false
+	}
+	defer q.Done(item)
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	err := processItem(ctx, item, process)
+	if policy == nil {
+		return true
+	}
+	if err != nil {
+		policy.Retry(item, err)
+	} else {
+		policy.Forget(item)
+	}
+	return true
+}
+
+func processItem[T comparable](ctx context.Context, item T, process ProcessFunc[T]) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic processing %v: %v", item, r)
+		}
+	}()
+	return process(ctx, item)
+}
+
+// rateLimitedRequeuePolicy requeues failed items through a rate limiting queue.
+type rateLimitedRequeuePolicy struct {
+	queue      RateLimitingInterface
+	maxRetries int
+}
+
+// NewRateLimitedRequeuePolicy returns a RequeuePolicy which adds failed items
+// back to q once its rate limiter allows it, and forgets them once they have
+// been processed successfully or have been retried maxRetries times. A
+// negative maxRetries retries forever.
+func NewRateLimitedRequeuePolicy(q RateLimitingInterface, maxRetries int) RequeuePolicy[interface{}] {
+	return &rateLimitedRequeuePolicy{
+		queue:      q,
+		maxRetries: maxRetries,
+	}
+}
+
+func (p *rateLimitedRequeuePolicy) Retry(item interface{}, err error) {
+	if p.maxRetries < 0 || p.queue.NumRequeues(item) < p.maxRetries {
+		p.queue.AddRateLimited(item)
+		return
+	}
+	p.queue.Forget(item)
+}
+
+func (p *rateLimitedRequeuePolicy) Forget(item interface{}) {
+	p.queue.Forget(item)
+}
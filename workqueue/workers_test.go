@@ -0,0 +1,161 @@
+package workqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingPolicy struct {
+	lock      sync.Mutex
+	retried   map[int]error
+	forgotten map[int]bool
+}
+
+func (p *recordingPolicy) Retry(item int, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.retried[item] = err
+}
+
+func (p *recordingPolicy) Forget(item int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.forgotten[item] = true
+}
+
+func TestRunWorkers(t *testing.T) {
+	q := NewTyped[int]()
+	for i := 0; i < 100; i++ {
+		q.Add(i)
+	}
+
+	policy := &recordingPolicy{retried: map[int]error{}, forgotten: map[int]bool{}}
+	errFailed := errors.New("failed")
+
+	var lock sync.Mutex
+	processed := map[int]bool{}
+	process := func(ctx context.Context, item int) error {
+		lock.Lock()
+		processed[item] = true
+		lock.Unlock()
+
+		switch item {
+		case 7:
+			return errFailed
+		case 13:
+			panic("unlucky")
+		}
+		return nil
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		RunWorkers[int](context.Background(), q, 8, process, policy)
+		close(finished)
+	}()
+
+	q.ShutDownWithDrain()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatalf("RunWorkers did not return once the queue was shut down")
+	}
+
+	if e, a := 100, len(processed); e != a {
+		t.Errorf("Expected %v processed items, got %v", e, a)
+	}
+	if e, a := 98, len(policy.forgotten); e != a {
+		t.Errorf("Expected %v forgotten items, got %v", e, a)
+	}
+	if err := policy.retried[7]; err != errFailed {
+		t.Errorf("Expected %v, got %v", errFailed, err)
+	}
+	if err := policy.retried[13]; err == nil {
+		t.Errorf("Expected the panic to be reported as an error")
+	}
+	if len(q.processing) != 0 {
+		t.Errorf("Expected every item to be Done, %v are still processing", len(q.processing))
+	}
+}
+
+func TestRunWorkersStopsOnContextDone(t *testing.T) {
+	q := New()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	finished := make(chan struct{})
+	go func() {
+		RunWorkers(ctx, q, 2, func(ctx context.Context, item interface{}) error {
+			return nil
+		}, nil)
+		close(finished)
+	}()
+
+	cancel()
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatalf("RunWorkers did not return once its context was canceled")
+	}
+	if !q.ShuttingDown() {
+		t.Errorf("Expected the queue to be shut down")
+	}
+}
+
+func TestRunWorkersStopsWithBacklog(t *testing.T) {
+	q := NewTyped[int]()
+	for i := 0; i < 1000; i++ {
+		q.Add(i)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	processed := 0
+	RunWorkers[int](ctx, q, 1, func(ctx context.Context, item int) error {
+		processed++
+		if processed == 10 {
+			cancel()
+		}
+		return nil
+	}, nil)
+
+	if e, a := 10, processed; e != a {
+		t.Errorf("Expected %v processed items, got %v", e, a)
+	}
+	if !q.ShuttingDown() {
+		t.Errorf("Expected the queue to be shut down")
+	}
+	if len(q.processing) != 0 {
+		t.Errorf("Expected every item to be Done, %v are still processing", len(q.processing))
+	}
+}
+
+func TestRateLimitedRequeuePolicy(t *testing.T) {
+	q := NewRateLimitingQueue(NewItemExponentialFailureRateLimiter(time.Millisecond, time.Millisecond))
+	defer q.ShutDown()
+	policy := NewRateLimitedRequeuePolicy(q, 2)
+
+	errFailed := errors.New("failed")
+	policy.Retry("foo", errFailed)
+	policy.Retry("foo", errFailed)
+	if e, a := 2, q.NumRequeues("foo"); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	if !waitForLen(q, 1, time.Second) {
+		t.Fatalf("Expected the failed item to be requeued")
+	}
+
+	// the item has been retried too many times
+	policy.Retry("foo", errFailed)
+	if e, a := 0, q.NumRequeues("foo"); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+
+	policy.Retry("bar", errFailed)
+	policy.Forget("bar")
+	if e, a := 0, q.NumRequeues("bar"); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+}
@@ -1,121 +1,563 @@
 package workqueue
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"time"
 )
 
-type Interface interface {
-	Add(item interface{})
+// ErrDrainInterrupted is returned when ShutDown is called while
+// ShutDownWithDrainContext waits for the queue to be drained.
+var ErrDrainInterrupted = errors.New("workqueue: drain interrupted by ShutDown")
+
+// Interface is the interface{} flavour of TypedInterface, kept so that
+// existing callers continue to compile.
+type Interface = TypedInterface[interface{}]
+
+type TypedInterface[T comparable] interface {
+	Add(item T)
 	Len() int
-	Get() (item interface{}, shutdown bool)
-	Done(item interface{})
+	Get() (item T, shutdown bool)
+	Done(item T)
 	ShutDown()
+	ShutDownWithDrain()
+	ShutDownWithDrainContext(ctx context.Context) error
 	ShuttingDown() bool
 }
 
+// QueueConfig specifies optional configurations to customize an Interface.
+type QueueConfig = TypedQueueConfig[interface{}]
+
+// TypedQueueConfig specifies optional configurations to customize a TypedInterface.
+type TypedQueueConfig[T comparable] struct {
+	// Name for the queue. If unnamed, the metrics will not be registered.
+	Name string
+
+	// MetricsProvider optionally allows specifying a metrics provider to use for the queue
+	// instead of the global provider.
+	MetricsProvider MetricsProvider
+
+	// Queue provides the underlying queue to use. It is optional and defaults to slice based FIFO queue.
+	Queue Queue[T]
+
+	// EventHandler is optionally called with every event happening to an
+	// item. It is called with the lock of the queue held, so it must not
+	// block nor call the queue.
+	EventHandler func(event ItemEvent[T])
+
+	// LeaseDuration optionally enables leases: an item handed out by
+	// GetWithLease must be done with DoneWithLease, or have its lease
+	// extended, within LeaseDuration. Otherwise it is queued again and the
+	// later DoneWithLease of the stale worker is ignored. Done and DoneBatch
+	// can't tell a stale worker apart from the current one, they are ignored
+	// while the item is leased. Items handed out by Get, GetWithContext or
+	// GetBatch have no lease and are done with Done as usual.
+	LeaseDuration time.Duration
+
+	// OnLeaseExpired is optionally called with every item whose lease
+	// expired, after it has been queued again.
+	OnLeaseExpired func(item T)
+}
+
+// Queue is the underlying storage for items. The functions below are always
+// called with the lock of the work queue held.
+type Queue[T comparable] interface {
+	// Touch can be hooked when an existing item is added again. This may be
+	// useful if the implementation allows priority change for the given item.
+	Touch(item T)
+	// Push adds a new item.
+	Push(item T)
+	// Len tells the total number of items.
+	Len() int
+	// Pop retrieves an item.
+	Pop() (item T)
+}
+
+// doneQueue is optionally implemented by a Queue which keeps track of the
+// items it popped. Done is called, with the lock of the work queue held, once
+// a popped item has been processed and is not pushed again.
+type doneQueue[T comparable] interface {
+	Done(item T)
+}
+
+// DefaultQueue is a slice based FIFO queue.
+func DefaultQueue[T comparable]() Queue[T] {
+	return new(queue[T])
+}
+
+// queue is a slice which implements Queue.
+type queue[T comparable] []T
+
+func (q *queue[T]) Touch(item T) {}
+
+func (q *queue[T]) Push(item T) {
+	*q = append(*q, item)
+}
+
+func (q *queue[T]) Len() int {
+	return len(*q)
+}
+
+func (q *queue[T]) Pop() (item T) {
+	item = (*q)[0]
+
+	// The underlying array still exists and reference this object, so the object will not be garbage collected.
+	(*q)[0] = *new(T)
+	*q = (*q)[1:]
+
+	return item
+}
+
 type empty struct{}
 type t interface{}
-type set map[t]empty
+type set[T comparable] map[T]empty
 
-func (s set) insert(k interface{}) {
+func (s set[T]) insert(k T) {
 	s[k] = empty{}
 }
 
-func (s set) delete(k interface{}) {
+func (s set[T]) delete(k T) {
 	delete(s, k)
 }
 
-func (s set) has(k interface{}) bool {
+func (s set[T]) has(k T) bool {
 	_, ok := s[k]
 	return ok
 }
 
-type Type struct {
-	queue []t
+// Type is the interface{} flavour of TypedType, kept so that existing
+// callers continue to compile.
+type Type = TypedType[interface{}]
+
+// TypedType is a work queue (see the package doc) of comparable items of type T.
+type TypedType[T comparable] struct {
+	// queue defines the order in which we will work on items. Every
+	// element of queue should be in the dirty set and not in the
+	// processing set.
+	queue Queue[T]
 
-	dirty      set
-	processing set
+	dirty      set[T]
+	processing set[T]
 
 	shuttingDown bool
+	drain        bool
 
 	cond *sync.Cond
+	// space is signaled when an item stops waiting to be processed, the
+	// producers of a bounded queue wait on it for room
+	space *sync.Cond
+	// batch is broadcast when an item is queued, the GetBatch waiters which
+	// already have items to return wait on it for more
+	batch *sync.Cond
+
+	metrics queueMetrics[T]
+
+	journal queueJournal[T]
+
+	tracker *itemTracker[T]
+
+	// leases holds the lease of every processing item handed out by
+	// GetWithLease when leaseDuration is set
+	leases         map[T]*itemLease
+	leaseDuration  time.Duration
+	leaseID        uint64
+	onLeaseExpired func(item T)
+
+	unfinishedWorkUpdatePeriod time.Duration
 }
 
 func New() *Type {
-	return &Type{
-		dirty:      make(set),
-		processing: make(set),
-		cond:       sync.NewCond(&sync.Mutex{}),
+	return NewWithConfig(QueueConfig{})
+}
+
+// NewNamed constructs a new queue whose metrics are reported under name to
+// the provider registered with SetProvider.
+func NewNamed(name string) *Type {
+	return NewWithConfig(QueueConfig{
+		Name: name,
+	})
+}
+
+// NewWithConfig constructs a new workqueue with ability to
+// customize different properties.
+func NewWithConfig(config QueueConfig) *Type {
+	return NewTypedWithConfig(config)
+}
+
+// NewTyped constructs a new work queue (see the package comment).
+func NewTyped[T comparable]() *TypedType[T] {
+	return NewTypedWithConfig(TypedQueueConfig[T]{})
+}
+
+// NewTypedWithConfig constructs a new workqueue with ability to
+// customize different properties.
+func NewTypedWithConfig[T comparable](config TypedQueueConfig[T]) *TypedType[T] {
+	return newQueueWithConfig(config, defaultUnfinishedWorkUpdatePeriod)
+}
+
+// newQueueWithConfig constructs a new named workqueue
+// with the ability to customize different properties for testing purposes
+func newQueueWithConfig[T comparable](config TypedQueueConfig[T], updatePeriod time.Duration) *TypedType[T] {
+	var metricsFactory *queueMetricsFactory
+	if config.MetricsProvider != nil {
+		metricsFactory = &queueMetricsFactory{
+			metricsProvider: config.MetricsProvider,
+		}
+	} else {
+		metricsFactory = &globalMetricsFactory
+	}
+
+	if config.Queue == nil {
+		config.Queue = DefaultQueue[T]()
 	}
+
+	t := newQueue(config.Queue, newQueueMetrics[T](metricsFactory.metricsProvider, config.Name), updatePeriod)
+	t.tracker.handler = config.EventHandler
+	t.leaseDuration = config.LeaseDuration
+	t.onLeaseExpired = config.OnLeaseExpired
+	return t
 }
 
-func (t *Type) Add(item interface{}) {
+func newQueue[T comparable](queue Queue[T], metrics queueMetrics[T], updatePeriod time.Duration) *TypedType[T] {
+	lock := &sync.Mutex{}
+	t := &TypedType[T]{
+		queue:                      queue,
+		dirty:                      set[T]{},
+		processing:                 set[T]{},
+		cond:                       sync.NewCond(lock),
+		space:                      sync.NewCond(lock),
+		batch:                      sync.NewCond(lock),
+		metrics:                    metrics,
+		journal:                    noJournal[T]{},
+		tracker:                    newItemTracker[T](),
+		leases:                     map[T]*itemLease{},
+		unfinishedWorkUpdatePeriod: updatePeriod,
+	}
+
+	// Don't start the goroutine for a type of noMetrics so we don't consume
+	// resources unnecessarily
+	if _, ok := metrics.(noMetrics[T]); !ok {
+		go t.updateUnfinishedWorkLoop()
+	}
+
+	return t
+}
+
+const defaultUnfinishedWorkUpdatePeriod = 500 * time.Millisecond
+
+func (t *TypedType[T]) Add(item T) {
 	t.cond.L.Lock()
 	defer t.cond.L.Unlock()
 
+	t.addLocked(item)
+}
+
+// addLocked marks item as needing processing. t.cond.L must be held.
+func (t *TypedType[T]) addLocked(item T) {
 	if t.shuttingDown {
 		return
 	}
 
 	if t.dirty.has(item) {
+		// the same item is added again before it is processed, call the Touch
+		// function if the queue cares about it (for e.g, reset its priority)
+		if !t.processing.has(item) {
+			t.queue.Touch(item)
+		}
+		t.tracker.dedup(item)
 		return
 	}
 
+	t.metrics.add(item)
+	t.journal.add(item)
+	t.tracker.add(item)
+
 	t.dirty.insert(item)
 
 	if !t.processing.has(item) {
-		t.queue = append(t.queue, item)
+		t.queue.Push(item)
+		t.batch.Broadcast()
 	}
 
 	t.cond.Signal()
 }
 
-func (t *Type) Get() (interface{}, bool) {
+func (t *TypedType[T]) Get() (T, bool) {
 	t.cond.L.Lock()
 	defer t.cond.L.Unlock()
 
-	for len(t.queue) == 0 && t.shuttingDown != true {
+	for t.queue.Len() == 0 && t.shuttingDown != true {
 		t.cond.Wait()
 	}
 
-	if len(t.queue) == 0 {
-		return nil, true
+	if t.queue.Len() == 0 {
+		var zero T
+		return zero, true
 	}
 
-	var item interface{}
+	return t.getLocked(), false
+}
+
+// GetWithContext is like Get, but gives up waiting for an item once ctx is
+// done, in which case it returns ctx.Err(). An item which is already queued
+// is returned even if ctx is done.
+func (t *TypedType[T]) GetWithContext(ctx context.Context) (item T, shutdown bool, err error) {
+	t.cond.L.Lock()
+	defer t.cond.L.Unlock()
+
+	if t.queue.Len() == 0 && !t.shuttingDown {
+		// wake every waiter up once ctx is done, the others go back to sleep.
+		// A waiter woken up by Signal always finds an item, which it returns
+		// before looking at ctx, so that no Signal is lost.
+		stop := context.AfterFunc(ctx, func() {
+			t.cond.L.Lock()
+			defer t.cond.L.Unlock()
+			t.cond.Broadcast()
+		})
+		defer stop()
+
+		for t.queue.Len() == 0 && !t.shuttingDown && ctx.Err() == nil {
+			t.cond.Wait()
+		}
+	}
+
+	if t.queue.Len() == 0 {
+		if t.shuttingDown {
+			return item, true, nil
+		}
+		return item, false, ctx.Err()
+	}
+
+	return t.getLocked(), false, nil
+}
+
+// GetWithTimeout is like GetWithContext with a context which is done after
+// timeout.
+func (t *TypedType[T]) GetWithTimeout(timeout time.Duration) (item T, shutdown bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return t.GetWithContext(ctx)
+}
+
+// getLocked moves the first queued item to the processing set. t.cond.L
+// must be held and the queue must not be empty.
+func (t *TypedType[T]) getLocked() T {
+	item := t.queue.Pop()
+
+	t.metrics.get(item)
+	t.journal.get(item)
+	t.tracker.get(item)
 
-	item, t.queue = t.queue[0], t.queue[1:]
 	t.dirty.delete(item)
 	t.processing.insert(item)
-	return item, false
+	t.space.Signal()
+	return item
+}
+
+// GetBatch blocks until at least one item can be processed, then waits up to
+// wait for the queue to hold max items. It returns up to max items, which are
+// all moved to the processing set at once and must each be marked as Done
+// (see DoneBatch). Once the queue is shut down and empty it returns shutdown.
+func (t *TypedType[T]) GetBatch(max int, wait time.Duration) ([]T, bool) {
+	if max < 1 {
+		max = 1
+	}
+
+	t.cond.L.Lock()
+	defer t.cond.L.Unlock()
+
+	expired := false
+	var timer *time.Timer
+	for {
+		for t.queue.Len() == 0 && !t.shuttingDown {
+			t.cond.Wait()
+		}
+		if t.queue.Len() == 0 {
+			return nil, true
+		}
+		if t.queue.Len() >= max || expired || t.shuttingDown || wait <= 0 {
+			break
+		}
+
+		if timer == nil {
+			timer = time.AfterFunc(wait, func() {
+				t.cond.L.Lock()
+				defer t.cond.L.Unlock()
+				expired = true
+				t.batch.Broadcast()
+			})
+			defer timer.Stop()
+		}
+		// the Signal which woke us up may have been meant for the queued
+		// items, pass it on to another waiter before waiting for more items
+		// apart from the Get waiters
+		t.cond.Signal()
+		t.batch.Wait()
+	}
+
+	n := t.queue.Len()
+	if n > max {
+		n = max
+	}
+	items := make([]T, n)
+	for i := range items {
+		items[i] = t.getLocked()
+	}
+
+	// the items left may have been signaled to us, pass them on
+	if t.queue.Len() > 0 {
+		t.cond.Signal()
+	}
+	return items, false
+}
+
+// Done marks item as done processing. It is ignored while item is leased,
+// see TypedQueueConfig.LeaseDuration.
+func (t *TypedType[T]) Done(item T) {
+	t.cond.L.Lock()
+	defer t.cond.L.Unlock()
+
+	if t.leased(item) {
+		return
+	}
+	t.doneLocked(item)
 }
 
-func (t *Type) Done(item interface{}) {
+// DoneBatch marks every item of a batch returned by GetBatch as done, see
+// Done.
+func (t *TypedType[T]) DoneBatch(items []T) {
 	t.cond.L.Lock()
 	defer t.cond.L.Unlock()
 
+	for _, item := range items {
+		if !t.leased(item) {
+			t.doneLocked(item)
+		}
+	}
+}
+
+// doneLocked marks item as done processing. t.cond.L must be held.
+func (t *TypedType[T]) doneLocked(item T) {
+	if !t.processing.has(item) {
+		// e.g. the lease of item expired and it has been queued again
+		return
+	}
+	t.revokeLease(item)
+
+	t.metrics.done(item)
+	t.journal.done(item)
+	t.tracker.done(item, t.dirty.has(item))
+
 	t.processing.delete(item)
 	if t.dirty.has(item) {
-		t.queue = append(t.queue, item)
+		t.queue.Push(item)
 		t.cond.Signal()
+		t.batch.Broadcast()
+		return
+	}
+	if q, ok := t.queue.(doneQueue[T]); ok {
+		q.Done(item)
+	}
+	if t.drain && len(t.processing) == 0 && t.queue.Len() == 0 {
+		// wake up ShutDownWithDrain, a Signal could be consumed by a Get
+		// waiter instead
+		t.cond.Broadcast()
 	}
 }
 
-func (t *Type) ShutDown() {
+// ShutDown will cause t to ignore all new items added to it and
+// immediately instruct the worker goroutines to exit once the queue is
+// empty, without waiting for items being processed. It is safe to call
+// ShutDown after ShutDownWithDrain to stop waiting for the drainage.
+func (t *TypedType[T]) ShutDown() {
 	t.cond.L.Lock()
 	defer t.cond.L.Unlock()
+	t.drain = false
 	t.shuttingDown = true
 	t.cond.Broadcast()
+	t.space.Broadcast()
+	t.batch.Broadcast()
+}
+
+// ShutDownWithDrain will cause t to ignore all new items added to it. The
+// worker goroutines keep pulling the items which are already queued and
+// ShutDownWithDrain returns once both the queue and the processing set are
+// empty. Workers must call Done on every item they got, otherwise this will
+// block until ShutDown is called.
+func (t *TypedType[T]) ShutDownWithDrain() {
+	t.ShutDownWithDrainContext(context.Background())
 }
 
-func (t *Type) Len() int {
+// ShutDownWithDrainContext is like ShutDownWithDrain, but stops waiting
+// when ctx is done, falling back to ShutDown. If the queue was not drained,
+// it returns ctx.Err() once ctx is done, or ErrDrainInterrupted if ShutDown
+// was called meanwhile.
+func (t *TypedType[T]) ShutDownWithDrainContext(ctx context.Context) error {
 	t.cond.L.Lock()
 	defer t.cond.L.Unlock()
-	return len(t.queue)
+
+	t.drain = true
+	t.shuttingDown = true
+	t.cond.Broadcast()
+	t.space.Broadcast()
+	t.batch.Broadcast()
+
+	stop := context.AfterFunc(ctx, func() {
+		t.cond.L.Lock()
+		defer t.cond.L.Unlock()
+		t.drain = false
+		t.cond.Broadcast()
+	})
+	defer stop()
+
+	for t.drain && (t.queue.Len() != 0 || len(t.processing) != 0) {
+		t.cond.Wait()
+	}
+
+	if t.queue.Len() != 0 || len(t.processing) != 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return ErrDrainInterrupted
+	}
+	return nil
+}
+
+// ShutDownWithDrainTimeout is like ShutDownWithDrain, but falls back to
+// ShutDown if the queue has not been drained within timeout.
+func (t *TypedType[T]) ShutDownWithDrainTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return t.ShutDownWithDrainContext(ctx)
 }
 
-func (t *Type) ShuttingDown() bool {
+func (t *TypedType[T]) Len() int {
+	t.cond.L.Lock()
+	defer t.cond.L.Unlock()
+	return t.queue.Len()
+}
+
+func (t *TypedType[T]) ShuttingDown() bool {
 	t.cond.L.Lock()
 	defer t.cond.L.Unlock()
 	return t.shuttingDown
 }
+
+func (t *TypedType[T]) updateUnfinishedWorkLoop() {
+	ticker := time.NewTicker(t.unfinishedWorkUpdatePeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !func() bool {
+			t.cond.L.Lock()
+			defer t.cond.L.Unlock()
+			if !t.shuttingDown {
+				t.metrics.updateUnfinishedWork()
+				return true
+			}
+			return false
+		}() {
+			return
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package workqueue
 
 import (
+	"context"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -91,3 +93,389 @@ func TestReinsert(t *testing.T) {
 		t.Errorf("Expected queue to be empty. Has %v items", a)
 	}
 }
+
+func TestTyped(t *testing.T) {
+	type key struct {
+		namespace, name string
+	}
+
+	q := NewTyped[key]()
+	foo := key{"default", "foo"}
+	bar := key{"default", "bar"}
+
+	q.Add(foo)
+	q.Add(bar)
+	q.Add(foo)
+	if e, a := 2, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+
+	i, _ := q.Get()
+	if i != foo {
+		t.Errorf("Expected %v, got %v", foo, i)
+	}
+
+	// re-adding an item that is being processed defers it until Done
+	q.Add(foo)
+	if e, a := 1, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	q.Done(foo)
+	if e, a := 2, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+
+	q.ShutDown()
+	for _, expected := range []key{bar, foo} {
+		i, shutdown := q.Get()
+		if shutdown {
+			t.Fatalf("Unexpected shutdown while items are queued")
+		}
+		if i != expected {
+			t.Errorf("Expected %v, got %v", expected, i)
+		}
+		q.Done(i)
+	}
+
+	i, shutdown := q.Get()
+	if !shutdown {
+		t.Errorf("Expected shutdown")
+	}
+	if i != (key{}) {
+		t.Errorf("Expected the zero value on shutdown, got %v", i)
+	}
+}
+
+func TestNewWithConfig(t *testing.T) {
+	mp := NewInMemoryMetricsProvider()
+	q := NewWithConfig(QueueConfig{
+		Name:            "config",
+		MetricsProvider: mp,
+	})
+	defer q.ShutDown()
+
+	q.Add("foo")
+	if e, a := 1.0, mp.Adds("config").Value(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+}
+
+func TestShutDownWithDrain(t *testing.T) {
+	q := New()
+	q.Add("foo")
+	q.Add("bar")
+
+	foo, _ := q.Get()
+
+	drained := make(chan struct{})
+	go func() {
+		q.ShutDownWithDrain()
+		close(drained)
+	}()
+
+	// wait for the shutdown to start, new items are then ignored
+	for !q.ShuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+	q.Add("baz")
+
+	bar, shutdown := q.Get()
+	if shutdown || bar != "bar" {
+		t.Fatalf("Expected to keep getting queued items while draining, got %v/%v", bar, shutdown)
+	}
+	q.Done(foo)
+
+	select {
+	case <-drained:
+		t.Fatalf("ShutDownWithDrain returned while an item was still processing")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	q.Done(bar)
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatalf("ShutDownWithDrain did not return once the queue was drained")
+	}
+
+	if _, shutdown := q.Get(); !shutdown {
+		t.Errorf("Expected Get to report shutdown")
+	}
+}
+
+func TestShutDownWithDrainTimeout(t *testing.T) {
+	q := New()
+	q.Add("foo")
+	foo, _ := q.Get()
+
+	if err := q.ShutDownWithDrainTimeout(20 * time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if !q.ShuttingDown() {
+		t.Errorf("Expected the queue to be shut down")
+	}
+	q.Done(foo)
+
+	q = New()
+	q.Add("foo")
+	foo, _ = q.Get()
+	q.Done(foo)
+	if err := q.ShutDownWithDrainTimeout(time.Second); err != nil {
+		t.Errorf("Expected an empty queue to drain, got %v", err)
+	}
+}
+
+func TestShutDownWhileDraining(t *testing.T) {
+	q := New()
+	q.Add("foo")
+	q.Get()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- q.ShutDownWithDrainContext(ctx)
+	}()
+
+	for !q.ShuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Errorf("Expected %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("ShutDownWithDrainContext did not return after its context was canceled")
+	}
+}
+
+func TestShutDownInterruptsDrain(t *testing.T) {
+	q := New()
+	q.Add("foo")
+	q.Get()
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- q.ShutDownWithDrainContext(context.Background())
+	}()
+
+	for !q.ShuttingDown() {
+		time.Sleep(time.Millisecond)
+	}
+	q.ShutDown()
+
+	select {
+	case err := <-errCh:
+		if err != ErrDrainInterrupted {
+			t.Errorf("Expected %v, got %v", ErrDrainInterrupted, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("ShutDownWithDrainContext did not return after ShutDown")
+	}
+}
+
+func TestGetBatch(t *testing.T) {
+	q := New()
+	for _, item := range []string{"a", "b", "c", "d", "e"} {
+		q.Add(item)
+	}
+	q.Add("a")
+
+	items, shutdown := q.GetBatch(3, 0)
+	if shutdown {
+		t.Fatalf("Unexpected shutdown")
+	}
+	if e, a := []interface{}{"a", "b", "c"}, items; !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	if e, a := 2, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+
+	// items of a batch are processing, re-adding them defers them until done
+	q.Add("a")
+	if e, a := 2, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	q.DoneBatch(items)
+	if e, a := 3, q.Len(); e != a {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+
+	items, _ = q.GetBatch(10, 0)
+	if e, a := []interface{}{"d", "e", "a"}, items; !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	q.DoneBatch(items)
+
+	q.ShutDown()
+	if items, shutdown := q.GetBatch(10, time.Second); !shutdown || items != nil {
+		t.Errorf("Expected shutdown, got %v/%v", items, shutdown)
+	}
+}
+
+func TestGetBatchWait(t *testing.T) {
+	q := New()
+	q.Add("a")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Add("b")
+		q.Add("c")
+	}()
+
+	items, _ := q.GetBatch(3, time.Minute)
+	if e, a := []interface{}{"a", "b", "c"}, items; !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	q.DoneBatch(items)
+
+	// the batch is returned incomplete once wait expires
+	q.Add("d")
+	items, _ = q.GetBatch(3, 10*time.Millisecond)
+	if e, a := []interface{}{"d"}, items; !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %v, got %v", e, a)
+	}
+	q.DoneBatch(items)
+}
+
+func TestGetBatchPassesSignalOn(t *testing.T) {
+	q := New()
+
+	batches := make(chan []interface{}, 1)
+	go func() {
+		items, _ := q.GetBatch(10, 2*time.Second)
+		batches <- items
+	}()
+	// let GetBatch wait first, so that it gets the Signal of Add
+	time.Sleep(10 * time.Millisecond)
+
+	got := make(chan interface{}, 1)
+	go func() {
+		item, _ := q.Get()
+		got <- item
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	q.Add("a")
+	select {
+	case item := <-got:
+		if e, a := "a", item; e != a {
+			t.Errorf("Expected %v, got %v", e, a)
+		}
+		q.Done(item)
+	case <-time.After(time.Second):
+		t.Fatalf("Get stayed blocked with %v item queued", q.Len())
+	}
+
+	q.ShutDown()
+	if items := <-batches; items != nil {
+		t.Errorf("Expected no batch, got %v", items)
+	}
+}
+
+func TestGetWithContext(t *testing.T) {
+	q := New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, shutdown, err := q.GetWithContext(ctx); shutdown || err != context.Canceled {
+		t.Errorf("Expected %v, got %v/%v", context.Canceled, shutdown, err)
+	}
+
+	// a queued item wins over a done context
+	q.Add("foo")
+	item, shutdown, err := q.GetWithContext(ctx)
+	if item != "foo" || shutdown || err != nil {
+		t.Errorf("Expected foo, got %v/%v/%v", item, shutdown, err)
+	}
+	q.Done(item)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Add("bar")
+	}()
+	item, _, err = q.GetWithTimeout(time.Minute)
+	if item != "bar" || err != nil {
+		t.Errorf("Expected bar, got %v/%v", item, err)
+	}
+	q.Done(item)
+
+	if _, _, err := q.GetWithTimeout(10 * time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.ShutDown()
+	}()
+	if _, shutdown, err := q.GetWithContext(context.Background()); !shutdown || err != nil {
+		t.Errorf("Expected shutdown, got %v/%v", shutdown, err)
+	}
+}
+
+func TestGetWithContextKeepsSignals(t *testing.T) {
+	q := New()
+	defer q.ShutDown()
+
+	const items = 200
+	got := make(chan interface{}, items)
+
+	// plain Get consumers
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				item, shutdown := q.Get()
+				if shutdown {
+					return
+				}
+				got <- item
+				q.Done(item)
+			}
+		}()
+	}
+
+	// consumers which keep giving up
+	stop := make(chan struct{})
+	defer close(stop)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				item, shutdown, err := q.GetWithTimeout(time.Microsecond)
+				if shutdown {
+					return
+				}
+				if err == nil {
+					got <- item
+					q.Done(item)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < items; i++ {
+		q.Add(i)
+	}
+
+	seen := map[interface{}]bool{}
+	for len(seen) < items {
+		select {
+		case item := <-got:
+			seen[item] = true
+		case <-time.After(time.Second):
+			t.Fatalf("Only %v of %v items were processed", len(seen), items)
+		}
+	}
+}